@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/piplabs/story-guardian/internal/config"
+)
+
+// showFormat is the output format of the config show command.
+var showFormat string
+
+// configCmd groups the commands about the configuration.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration.",
+	// The configuration commands work without a valid configuration.
+	PersistentPreRunE: skipConfig,
+}
+
+// configExampleCmd prints an example configuration file.
+var configExampleCmd = &cobra.Command{
+	Use:   "example",
+	Short: "Print an example configuration file documenting every setting with its default.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.WriteExample(cmd.OutOrStdout())
+	},
+}
+
+// configValidateCmd checks the configuration and reports every problem found.
+var configValidateCmd = &cobra.Command{
+	Use:          "validate",
+	Short:        "Check the configuration and report every problem found.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := config.ReadSources(configFile, cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		return runConfigValidate(cmd.OutOrStdout(), sources)
+	},
+}
+
+// configShowCmd prints the effective configuration.
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration and where each value comes from, with secrets masked.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if showFormat != statsFormatTable && showFormat != statsFormatJSON {
+			return fmt.Errorf("invalid --format %q, expected %s or %s", showFormat, statsFormatTable, statsFormatJSON)
+		}
+		sources, err := config.ReadSources(configFile, cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		return runConfigShow(cmd.OutOrStdout(), sources, showFormat)
+	},
+}
+
+// initConfigCmd registers the config commands.
+func initConfigCmd() {
+	configShowCmd.Flags().StringVar(&showFormat, "format", statsFormatTable, "Output format, table or json")
+
+	configCmd.AddCommand(configExampleCmd, configValidateCmd, configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// skipConfig replaces loading the configuration for commands that do not need it.
+func skipConfig(*cobra.Command, []string) error {
+	return nil
+}
+
+// runConfigValidate writes the warnings and problems of the configuration to w, it fails if there are problems.
+func runConfigValidate(w io.Writer, sources *config.Sources) error {
+	for _, warning := range sources.Warnings() {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	_, err := sources.DaemonConfig()
+	problems := config.Problems(err)
+	for _, problem := range problems {
+		fmt.Fprintf(w, "error: %s\n", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("configuration has %d problem(s)", len(problems))
+	}
+
+	fmt.Fprintln(w, "Configuration is valid.")
+	return nil
+}
+
+// runConfigShow writes the effective settings to w.
+func runConfigShow(w io.Writer, sources *config.Sources, format string) error {
+	if format == statsFormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			File     string                `json:"file"`
+			Settings []config.SettingValue `json:"settings"`
+		}{File: sources.File(), Settings: sources.Values()})
+	}
+
+	file := sources.File()
+	if file == "" {
+		file = "none"
+	}
+	fmt.Fprintf(w, "Configuration file: %s\n\n", file)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, value := range sources.Values() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", value.Key, value.Value, value.Source)
+	}
+
+	return tw.Flush()
+}
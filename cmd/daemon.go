@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+	"github.com/piplabs/story-guardian/internal/config"
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// configWatchDelay is how long the configuration file must stay unchanged before it is reloaded, so a file
+// written in several steps is read once it is complete.
+const configWatchDelay = 500 * time.Millisecond
+
+// daemon holds the configuration of the running daemon and the clients built from it. A reload swaps both at
+// once, so the scheduler and the tail mode never see a configuration mixed from two versions. The daemon
+// implements cipherowl.API by delegating to the current client.
+type daemon struct {
+	state   atomic.Pointer[daemonState]
+	timings httpclient.TimingsRecorder
+
+	// reloadMu serializes reloads.
+	reloadMu sync.Mutex
+	// scheduleChanged and tailChanged wake the scheduler and the tail supervisor after a reload.
+	scheduleChanged chan struct{}
+	tailChanged     chan struct{}
+}
+
+// daemonState is a configuration with the clients built from it.
+type daemonState struct {
+	conf       *config.AppConfig
+	api        cipherowl.API
+	httpClient *httpclient.Client
+	breakers   *circuitbreaker.Set
+}
+
+// newDaemon builds the clients of conf. The request timings are reported to timings if it is not nil.
+func newDaemon(conf *config.AppConfig, timings httpclient.TimingsRecorder) (*daemon, error) {
+	d := &daemon{
+		timings:         timings,
+		scheduleChanged: make(chan struct{}, 1),
+		tailChanged:     make(chan struct{}, 1),
+	}
+	state, err := d.newState(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.state.Store(state)
+
+	return d, nil
+}
+
+// current returns the current configuration and clients.
+func (d *daemon) current() *daemonState {
+	return d.state.Load()
+}
+
+// breakers returns the circuit breakers of the current HTTP client.
+func (d *daemon) breakers() *circuitbreaker.Set {
+	return d.current().breakers
+}
+
+// newState builds the clients of conf. The clients of prev are kept if the settings they are built from did
+// not change, so a reload of the schedule keeps the pooled connections, the cached access token and the states
+// of the circuit breakers.
+func (d *daemon) newState(conf *config.AppConfig, prev *daemonState) (*daemonState, error) {
+	if prev != nil && reflect.DeepEqual(clientSettings(prev.conf), clientSettings(conf)) {
+		return &daemonState{conf: conf, api: prev.api, httpClient: prev.httpClient, breakers: prev.breakers}, nil
+	}
+
+	if err := conf.ValidateCredentials(); err != nil {
+		return nil, err
+	}
+	credentials := cipherowl.NewFileCredentials(conf.ClientID, conf.ClientIDFile, conf.ClientSecret, conf.ClientSecretFile)
+	if _, _, err := credentials.Credentials(); err != nil {
+		return nil, fmt.Errorf("failed to load client credentials: %w", err)
+	}
+	httpConf, err := conf.HTTP.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP configuration: %w", err)
+	}
+	// Requests to an endpoint that keeps failing fail fast until its breaker lets trial requests through.
+	breakers := circuitbreaker.NewSet(conf.CircuitBreaker.BreakerConfig(), logBreakerChange)
+	if prev != nil && prev.conf.CircuitBreaker == conf.CircuitBreaker {
+		breakers = prev.breakers
+	}
+	httpConf.Middlewares = append(httpConf.Middlewares, httpclient.CircuitBreaker(breakers))
+	httpConf.Timings = d.timings
+	httpClient, err := httpclient.New(httpConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize HTTP client: %w", err)
+	}
+
+	// Share one client, and with it the connection pool and the cached access token, between the periodic
+	// task and the tail mode uploads.
+	api := cipherowl.NewClient(
+		cipherowl.WithAPIConfig(conf.API),
+		cipherowl.WithCredentialsSource(credentials),
+		cipherowl.WithHTTPClient(httpClient),
+		cipherowl.WithTokenRetryPolicy(conf.Retry.TokenPolicy()),
+	)
+
+	return &daemonState{conf: conf, api: api, httpClient: httpClient, breakers: breakers}, nil
+}
+
+// clientSettings returns the settings the clients are built from.
+func clientSettings(conf *config.AppConfig) any {
+	return struct {
+		ClientID, ClientSecret, ClientIDFile, ClientSecretFile string
+		API                                                    config.APIConfig
+		TokenRetry                                             config.RetryPolicyConfig
+		MaxServerDelay                                         time.Duration
+		HTTP                                                   config.HTTPConfig
+		CircuitBreaker                                         config.CircuitBreakerConfig
+	}{
+		conf.ClientID, conf.ClientSecret, conf.ClientIDFile, conf.ClientSecretFile,
+		conf.API, conf.Retry.Token, conf.Retry.MaxServerDelay, conf.HTTP, conf.CircuitBreaker,
+	}
+}
+
+// reload applies a validated configuration. If its clients cannot be built, the current configuration is kept
+// and the error is returned.
+func (d *daemon) reload(conf *config.AppConfig) error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	prev := d.current()
+	state, err := d.newState(conf, prev)
+	if err != nil {
+		return err
+	}
+	d.state.Store(state)
+
+	// Requests in flight finish on the replaced client, its idle connections are no longer needed.
+	if state.httpClient != prev.httpClient {
+		prev.httpClient.CloseIdleConnections()
+	}
+	if conf.Metrics.Listen != prev.conf.Metrics.Listen || conf.Reload.Watch != prev.conf.Reload.Watch {
+		log.Println("warning: changes of metrics.listen and reload.watch take effect after a restart")
+	}
+	notify(d.scheduleChanged)
+	notify(d.tailChanged)
+
+	return nil
+}
+
+// notify wakes the receiver of ch without blocking, a pending notification is not duplicated.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// watchReloads reloads the configuration with load on SIGHUP and, if watch is set, whenever the contents of the
+// configuration file change, until the context is done.
+func (d *daemon) watchReloads(ctx context.Context, load func() (*config.AppConfig, error), file string, watch bool) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var changes <-chan struct{}
+	if watch {
+		if file == "" {
+			log.Println("Not watching the configuration: no configuration file was read")
+		} else if ch, err := watchFile(ctx, file); err != nil {
+			log.Printf("Failed to watch configuration file %s: %v", file, err)
+		} else {
+			changes = ch
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			d.reloadWith("SIGHUP", load)
+		case <-changes:
+			d.reloadWith("change of "+file, load)
+		}
+	}
+}
+
+// reloadWith loads the configuration and applies it, logging why the current configuration is kept on failure.
+func (d *daemon) reloadWith(trigger string, load func() (*config.AppConfig, error)) {
+	log.Printf("Reloading configuration on %s", trigger)
+	conf, err := load()
+	if err == nil {
+		err = d.reload(conf)
+	}
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping the current configuration: %v", err)
+		return
+	}
+	log.Println("Configuration reloaded successfully.")
+}
+
+// watchFile notifies the returned channel when the contents of file change, until the context is done. The
+// directory is watched, so a file replaced by a rename, as editors and Kubernetes config maps do, is noticed.
+func watchFile(ctx context.Context, file string) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	sum, _ := fileChecksum(file)
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer watcher.Close()
+
+		debounce := time.NewTimer(configWatchDelay)
+		debounce.Stop()
+		defer debounce.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(configWatchDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Configuration file watcher error: %v", err)
+			case <-debounce.C:
+				// Other files of the directory and rewrites with the same contents are no change.
+				newSum, err := fileChecksum(file)
+				if err != nil || bytes.Equal(newSum, sum) {
+					continue
+				}
+				sum = newSum
+				notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// fileChecksum returns the SHA-256 checksum of the contents of a file.
+func fileChecksum(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// FetchBloomFilterURL implements cipherowl.API with the current client.
+func (d *daemon) FetchBloomFilterURL(ctx context.Context) (string, error) {
+	return d.current().api.FetchBloomFilterURL(ctx)
+}
+
+// DownloadFile implements cipherowl.API with the current client.
+func (d *daemon) DownloadFile(ctx context.Context, url string) (io.ReadCloser, error) {
+	return d.current().api.DownloadFile(ctx, url)
+}
+
+// UploadReport implements cipherowl.API with the current client.
+func (d *daemon) UploadReport(ctx context.Context, batchID string, body []byte, contentType string) (*cipherowl.UploadReceipt, error) {
+	return d.current().api.UploadReport(ctx, batchID, body, contentType)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/config"
+)
+
+// testAppConfig returns a valid configuration with the defaults.
+func testAppConfig(t *testing.T) *config.AppConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("client_id: id\nclient_secret: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.NewAppConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+// notified reports whether ch holds a notification, consuming it.
+func notified(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func Test_newDaemon_RequiresCredentials(t *testing.T) {
+	conf := testAppConfig(t)
+	conf.ClientSecret = ""
+	if _, err := newDaemon(conf, nil); err == nil {
+		t.Errorf("newDaemon() error = nil, want an error for the missing client secret")
+	}
+}
+
+func Test_daemon_reload(t *testing.T) {
+	initial := testAppConfig(t)
+	d, err := newDaemon(initial, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := d.current()
+
+	// A new schedule keeps the clients, and with them the cached token and the pooled connections.
+	rescheduled := *initial
+	rescheduled.Schedule.Time = "05:30"
+	if err := d.reload(&rescheduled); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := d.current(); got.conf != &rescheduled || got.api != first.api {
+		t.Errorf("reload() of the schedule did not keep the API client")
+	}
+	if !notified(d.scheduleChanged) || !notified(d.tailChanged) {
+		t.Errorf("reload() did not notify the scheduler and the tail mode")
+	}
+
+	// New endpoints replace the client, the breakers are kept as their settings did not change.
+	moved := rescheduled
+	moved.API.BaseURL = "https://staging.example.com/"
+	if err := d.reload(&moved); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := d.current(); got.api == first.api || got.breakers != first.breakers {
+		t.Errorf("reload() of the endpoints did not replace only the API client")
+	}
+
+	// A configuration whose clients cannot be built is rejected as a whole.
+	broken := moved
+	broken.Schedule.Time = "07:00"
+	broken.ClientID, broken.ClientIDFile = "", filepath.Join(t.TempDir(), "missing")
+	if err := d.reload(&broken); err == nil {
+		t.Fatalf("reload() error = nil, want the credentials error")
+	}
+	if got := d.current(); got.conf != &moved {
+		t.Errorf("reload() applied a broken configuration")
+	}
+}
+
+func Test_watchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("schedule:\n  time: \"00:00\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := watchFile(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the file by a rename, as editors do.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("schedule:\n  time: \"05:30\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchFile() did not notify the change of the file")
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/piplabs/story-guardian/internal/fakecipherowl"
+)
+
+// fakeServerShutdownTimeout bounds how long in-flight requests are awaited on shutdown.
+const fakeServerShutdownTimeout = 5 * time.Second
+
+// Flags of the fake-server command.
+var (
+	fakeServerListen        string
+	fakeServerFilterFile    string
+	fakeServerClientID      string
+	fakeServerClientSecret  string
+	fakeServerTokenTTL      time.Duration
+	fakeServerLatency       time.Duration
+	fakeServerFailureRate   float64
+	fakeServerFailureStatus int
+)
+
+// fakeServerCmd runs a fake CipherOwl API for local end-to-end testing.
+var fakeServerCmd = &cobra.Command{
+	Use:   "fake-server",
+	Short: "Run a fake CipherOwl API for local integration testing.",
+	Long: `Run a fake CipherOwl API serving the token, bloom filter, download and upload endpoints.
+Point the daemon at it with CIPHEROWL_API_BASE_URL=http://<listen address>/.`,
+	Args: cobra.NoArgs,
+	// The fake server needs no guardian configuration or credentials.
+	PersistentPreRunE: skipConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fakeServerFailureRate < 0 || fakeServerFailureRate > 1 {
+			return fmt.Errorf("invalid --failure-rate %v, expected a value between 0 and 1", fakeServerFailureRate)
+		}
+
+		var filter []byte
+		if fakeServerFilterFile != "" {
+			var err error
+			if filter, err = os.ReadFile(fakeServerFilterFile); err != nil {
+				return fmt.Errorf("failed to read filter file: %w", err)
+			}
+		}
+
+		fake := fakecipherowl.New(fakecipherowl.Config{
+			ClientID:      fakeServerClientID,
+			ClientSecret:  fakeServerClientSecret,
+			Filter:        filter,
+			TokenTTL:      fakeServerTokenTTL,
+			Latency:       fakeServerLatency,
+			FailureRate:   fakeServerFailureRate,
+			FailureStatus: fakeServerFailureStatus,
+			Logger:        log.Default(),
+		})
+
+		return runFakeServer(cmd.Context(), fakeServerListen, fake)
+	},
+}
+
+// initFakeServerCmd registers the fake-server command and its flags.
+func initFakeServerCmd() {
+	fakeServerCmd.Flags().StringVar(&fakeServerListen, "listen", "127.0.0.1:8090", "Address to listen on")
+	fakeServerCmd.Flags().StringVar(&fakeServerFilterFile, "filter-file", "", "File served as bloom filter, empty by default")
+	fakeServerCmd.Flags().StringVar(&fakeServerClientID, "client-id", "", "Accepted client ID, any credentials are accepted if unset")
+	fakeServerCmd.Flags().StringVar(&fakeServerClientSecret, "client-secret", "", "Accepted client secret")
+	fakeServerCmd.Flags().DurationVar(&fakeServerTokenTTL, "token-ttl", time.Hour, "Lifetime of issued access tokens")
+	fakeServerCmd.Flags().DurationVar(&fakeServerLatency, "latency", 0, "Delay added to every response")
+	fakeServerCmd.Flags().Float64Var(&fakeServerFailureRate, "failure-rate", 0, "Fraction of requests answered with --failure-status, between 0 and 1")
+	fakeServerCmd.Flags().IntVar(&fakeServerFailureStatus, "failure-status", http.StatusServiceUnavailable, "HTTP status of injected failures")
+
+	rootCmd.AddCommand(fakeServerCmd)
+}
+
+// runFakeServer serves the fake API on addr until the context is done.
+func runFakeServer(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), fakeServerShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("fake-server: listening on http://%s/", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
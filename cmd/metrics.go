@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// metricsShutdownTimeout bounds how long in-flight metrics requests are awaited on shutdown.
+const metricsShutdownTimeout = 5 * time.Second
+
+// publishCircuitBreakers exports the states of the current breakers as the circuit_breakers metric.
+func publishCircuitBreakers(breakers func() *circuitbreaker.Set) {
+	expvar.Publish("circuit_breakers", expvar.Func(func() any {
+		return breakers().Statuses()
+	}))
+}
+
+// timingMetrics exports the request timings per endpoint as the http_timings metric: the number of requests and
+// the total seconds spent in each phase, from which the averages follow.
+type timingMetrics struct {
+	mu        sync.Mutex
+	endpoints *expvar.Map
+}
+
+// publishTimingMetrics creates and publishes the http_timings metric.
+func publishTimingMetrics() *timingMetrics {
+	m := &timingMetrics{endpoints: new(expvar.Map)}
+	expvar.Publish("http_timings", m.endpoints)
+
+	return m
+}
+
+// ObserveTimings implements httpclient.TimingsRecorder.
+func (m *timingMetrics) ObserveTimings(method, endpoint string, timings httpclient.Timings) {
+	m.mu.Lock()
+	stats, ok := m.endpoints.Get(endpoint).(*expvar.Map)
+	if !ok {
+		stats = new(expvar.Map)
+		m.endpoints.Set(endpoint, stats)
+	}
+	m.mu.Unlock()
+
+	stats.Add("requests", 1)
+	if timings.ReusedConn {
+		stats.Add("reused_connections", 1)
+	}
+	stats.AddFloat("dns_seconds", timings.DNS.Seconds())
+	stats.AddFloat("connect_seconds", timings.Connect.Seconds())
+	stats.AddFloat("tls_seconds", timings.TLS.Seconds())
+	stats.AddFloat("ttfb_seconds", timings.TimeToFirstByte.Seconds())
+	stats.AddFloat("transfer_seconds", timings.Transfer.Seconds())
+	stats.AddFloat("total_seconds", timings.Total.Seconds())
+}
+
+// logBreakerChange logs the state changes of the circuit breakers.
+func logBreakerChange(endpoint string, from, to circuitbreaker.State) {
+	log.Printf("Circuit breaker for %s changed from %s to %s", endpoint, from, to)
+}
+
+// startMetricsServer serves the published metrics at /debug/vars on addr until the context is done.
+func startMetricsServer(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving metrics on http://%s/debug/vars", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Metrics server failed: %v", err)
+	}
+}
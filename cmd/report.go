@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/archive"
+	"github.com/piplabs/story-guardian/internal/report"
+	"github.com/piplabs/story-guardian/utils/ctxutil"
+)
+
+const (
+	statsFormatTable = "table"
+	statsFormatJSON  = "json"
+
+	// dateFlagLayout is the layout of a date-only --since/--until value.
+	dateFlagLayout = "2006-01-02"
+)
+
+// Flags of the report stats command.
+var (
+	statsSince  string
+	statsUntil  string
+	statsFormat string
+	statsTop    int
+)
+
+// reportCmd groups the commands inspecting the filtered report.
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Inspect the filtered transaction reports.",
+}
+
+// reportStatsCmd summarizes the filtered transactions of the current, pending and archived reports.
+var reportStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize filtered transactions of the current, pending and archived reports.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseTimeFlag(statsSince, false)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		until, err := parseTimeFlag(statsUntil, true)
+		if err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+		if statsFormat != statsFormatTable && statsFormat != statsFormatJSON {
+			return fmt.Errorf("invalid --format %q, expected %s or %s", statsFormat, statsFormatTable, statsFormatJSON)
+		}
+
+		return runReportStats(cmd.Context(), cmd.OutOrStdout(), since, until, statsFormat, statsTop)
+	},
+}
+
+// initReportCmd registers the report commands and their flags.
+func initReportCmd() {
+	reportStatsCmd.Flags().StringVar(&statsSince, "since", "", "Only count transactions at or after this date (YYYY-MM-DD) or time (RFC 3339)")
+	reportStatsCmd.Flags().StringVar(&statsUntil, "until", "", "Only count transactions up to this date (YYYY-MM-DD, inclusive) or before this time (RFC 3339)")
+	reportStatsCmd.Flags().StringVar(&statsFormat, "format", statsFormatTable, "Output format, table or json")
+	reportStatsCmd.Flags().IntVar(&statsTop, "top", 10, "Number of addresses listed in the rankings")
+
+	reportCmd.AddCommand(reportStatsCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+// runReportStats aggregates every known report and writes the statistics to w.
+func runReportStats(ctx context.Context, w io.Writer, since, until time.Time, format string, top int) error {
+	agg := report.NewAggregator(since, until)
+
+	// The current report file and the batches waiting for upload.
+	paths := []string{filteredReportFilePath}
+	pending, err := internal.PendingBatchFiles(filteredReportFilePath)
+	if err != nil {
+		return err
+	}
+	paths = append(paths, pending...)
+	for _, path := range paths {
+		if err := addReportFile(agg, path); err != nil {
+			return err
+		}
+	}
+
+	// The reports archived after their upload.
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil && conf.Archive.Dir != "" {
+		archiver := archive.New(conf.Archive.Dir, conf.Archive.MaxAge, conf.Archive.MaxSize)
+		entries, err := archiver.Entries()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := addArchivedReport(agg, archiver, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	stats := agg.Stats(top)
+	if format == statsFormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	return writeStatsTable(w, stats)
+}
+
+// addReportFile adds a plain report file, a missing file is skipped.
+func addReportFile(agg *report.Aggregator, path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	skipped, err := agg.AddReader(file)
+	if skipped > 0 {
+		log.Printf("skipped %d malformed lines in %s", skipped, path)
+	}
+
+	return err
+}
+
+// addArchivedReport adds a compressed report of the archive, a pruned report is skipped.
+func addArchivedReport(agg *report.Aggregator, archiver *archive.Archiver, entry archive.Entry) error {
+	r, err := archiver.Open(entry)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	skipped, err := agg.AddReader(r)
+	if skipped > 0 {
+		log.Printf("skipped %d malformed lines in archived report %s", skipped, entry.File)
+	}
+
+	return err
+}
+
+// writeStatsTable writes the statistics as human-readable tables.
+func writeStatsTable(w io.Writer, stats report.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Filtered transactions:\t%d\n", stats.Total)
+	fmt.Fprintf(tw, "Total value (wei):\t%s\n", stats.TotalValue)
+
+	fmt.Fprintf(tw, "\nDAY\tCOUNT\n")
+	for _, day := range stats.PerDay {
+		fmt.Fprintf(tw, "%s\t%d\n", day.Day, day.Count)
+	}
+
+	fmt.Fprintf(tw, "\nTOP FILTERED ADDRESSES\tCOUNT\n")
+	for _, address := range stats.TopFilteredAddresses {
+		fmt.Fprintf(tw, "%s\t%d\n", address.Address, address.Count)
+	}
+
+	fmt.Fprintf(tw, "\nTOP SENDERS\tCOUNT\n")
+	for _, sender := range stats.TopSenders {
+		fmt.Fprintf(tw, "%s\t%d\n", sender.Address, sender.Count)
+	}
+
+	return tw.Flush()
+}
+
+// parseTimeFlag parses a date or RFC 3339 time. A date used as upper bound includes the whole day.
+func parseTimeFlag(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(dateFlagLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC 3339 time, got %q", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/report"
+)
+
+func Test_parseTimeFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		endOfDay bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:  "empty value",
+			value: "",
+			want:  time.Time{},
+		},
+		{
+			name:  "RFC 3339 time",
+			value: "2024-11-14T17:14:05Z",
+			want:  time.Date(2024, 11, 14, 17, 14, 5, 0, time.UTC),
+		},
+		{
+			name:  "date as lower bound",
+			value: "2024-11-14",
+			want:  time.Date(2024, 11, 14, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:     "date as upper bound includes the day",
+			value:    "2024-11-14",
+			endOfDay: true,
+			want:     time.Date(2024, 11, 15, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:    "invalid value",
+			value:   "yesterday",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeFlag(tt.value, tt.endOfDay)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimeFlag() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runReportStats(t *testing.T) {
+	const line = "timestamp: 2024-11-14T17:14:05+08:00, filtered_address: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, tx_hash: 0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85, type: 0, from: 0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58, to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, value: 42, nonce: 0, gas: 0, gas_price: 0\n"
+
+	reportFilePath := filepath.Join(t.TempDir(), "filtered_report.log")
+	defer func(path string) { filteredReportFilePath = path }(filteredReportFilePath)
+	filteredReportFilePath = reportFilePath
+
+	// The same line in the report file and a pending batch is counted once.
+	if err := os.WriteFile(reportFilePath, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.StageReportBatch(reportFilePath, []byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := runReportStats(context.Background(), &buf, time.Time{}, time.Time{}, statsFormatJSON, 10); err != nil {
+		t.Fatalf("runReportStats() error = %v", err)
+	}
+
+	var stats report.Stats
+	if err := json.Unmarshal(buf.Bytes(), &stats); err != nil {
+		t.Fatalf("runReportStats() wrote invalid JSON: %v", err)
+	}
+	if stats.Total != 1 || stats.TotalValue.String() != "42" {
+		t.Errorf("runReportStats() total = %d, value = %s, want 1 and 42", stats.Total, stats.TotalValue)
+	}
+}
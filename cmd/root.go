@@ -2,58 +2,107 @@ package cmd
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
+	"os"
 	"time"
 
-	"github.com/avast/retry-go/v4"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
 	"github.com/piplabs/story-guardian/internal/config"
 	"github.com/piplabs/story-guardian/utils"
 	"github.com/piplabs/story-guardian/utils/ctxutil"
 )
 
-const (
-	retryDelay    = 3 * time.Second
-	retryAttempts = 6
+// configFile is the configuration file set by --config.
+var configFile string
 
-	// filteredReportFileName represents the log filename for storing filtered transactions.
-	filteredReportFileName = "filtered_report.log"
+// The bloom filter directories, the report file and the configuration file of the loaded configuration.
+var (
+	outputDirs             []string
+	filteredReportFilePath string
+	loadedConfigFile       string
 )
 
-// Global variable to hold the output directory.
-var outputDir string
-var filteredReportFilePath = filepath.Join(utils.GetDefaultPath(), filteredReportFileName)
-
 // rootCmd is the root command for the Story Guardian.
 var rootCmd = &cobra.Command{
 	Use:   "story-guardian",
 	Short: "A tool that regularly downloads Bloom filter files and uploads filter report files.",
-	Run: func(cmd *cobra.Command, args []string) {
-		startTask(cmd.Context())
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		conf := ctxutil.GetAppConfig(ctx)
+		d, err := newDaemon(conf, publishTimingMetrics())
+		if err != nil {
+			return err
+		}
+		publishCircuitBreakers(d.breakers)
+		if conf.Metrics.Listen != "" {
+			go startMetricsServer(ctx, conf.Metrics.Listen)
+		}
+		// Reloads keep the flags of the command line, they override the reloaded file as before.
+		go d.watchReloads(ctx, func() (*config.AppConfig, error) {
+			conf, _, err := readConfig(cmd)
+			return conf, err
+		}, loadedConfigFile, conf.Reload.Watch)
+		go superviseTail(ctx, d)
+		startTask(ctx, d)
+
+		return nil
 	},
 }
 
-// Init Initializes the command-line flags and bind them to Viper configurations.
+// Init Initializes the command-line flags and the subcommands.
 func Init() {
-	// Register the output directory flag and bind it with Viper.
-	rootCmd.PersistentFlags().StringVarP(&outputDir, "output-dir", "o", utils.GetDefaultPath(), "Directory to store the bloom filter file")
-	if err := viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output-dir")); err != nil {
-		log.Fatalf("failed to bind output flag with viper, err: %v", err)
-	}
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "",
+		"Configuration file, YAML or TOML (default: config.yaml or config.toml in "+utils.GetDefaultPath()+")")
+	// The flags override the network and output_dir settings of the configuration.
+	rootCmd.PersistentFlags().String("network", "",
+		"Story network whose profile sets the paths, the filter ID and the endpoints: mainnet, aeneid, local or a profile of the configuration file")
+	rootCmd.PersistentFlags().StringSliceP("output-dir", "o", []string{utils.GetDefaultPath()},
+		"Directory to store the bloom filter file, repeat the flag or separate directories by commas to install the filter into several")
+
+	initReportCmd()
+	initFakeServerCmd()
+	initConfigCmd()
+}
 
-	conf, err := config.NewAppConfig()
+// loadConfig loads the configuration, after the flags of cmd are parsed, and stores it in the context of cmd.
+func loadConfig(cmd *cobra.Command) error {
+	conf, file, err := readConfig(cmd)
 	if err != nil {
-		log.Fatalf("failed to initialize configuration: %v", err)
+		return fmt.Errorf("failed to initialize configuration: %w", err)
 	}
-	rootCmd.SetContext(ctxutil.WithAppConfig(context.Background(), conf))
+	outputDirs = conf.OutputDirs
+	filteredReportFilePath = conf.ReportFile
+	loadedConfigFile = file
 
+	cmd.SetContext(ctxutil.WithAppConfig(cmd.Context(), conf))
 	log.Println("Configuration initialized successfully.")
+
+	return nil
+}
+
+// readConfig reads and validates the configuration with the flags of cmd, returning the configuration file it
+// was read from.
+func readConfig(cmd *cobra.Command) (*config.AppConfig, string, error) {
+	sources, err := config.ReadSources(configFile, cmd.Flags())
+	if err != nil {
+		return nil, "", err
+	}
+	for _, warning := range sources.Warnings() {
+		log.Printf("warning: %s", warning)
+	}
+	conf, err := sources.AppConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return conf, sources.File(), nil
 }
 
 // Execute is the main entry point to start the Cobra CLI.
@@ -63,95 +112,100 @@ func Execute() {
 	}
 }
 
-// startTask initializes a periodic task, downloading Bloom filter files and uploading filter report files once a day.
-func startTask(ctx context.Context) {
+// startTask initializes a periodic task, downloading Bloom filter files and uploading filter report files once a day
+// at the scheduled time of the current configuration.
+func startTask(ctx context.Context, d *daemon) {
 	for {
-		// Calculate the time to next midnight.
+		// Calculate the time to the next scheduled run.
 		now := time.Now()
-		nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		sleepDuration := nextMidnight.Sub(now)
+		sleepDuration := d.current().conf.Schedule.Next(now).Sub(now)
 
-		// Create a timer to wait until next midnight or until the context is done.
+		// Create a timer to wait until the next scheduled run or until the context is done.
 		timer := time.NewTimer(sleepDuration)
 		select {
 		case <-ctx.Done():
 			timer.Stop()
 			log.Println("startTask: received context cancellation, shutting down.")
 			return
+		case <-d.scheduleChanged:
+			// The schedule may have been reloaded, calculate the next run again.
+			timer.Stop()
+			continue
 		case <-timer.C:
 			// Continue with the task execution below.
 		}
 
-		conf := ctxutil.GetAppConfig(ctx)
-		accessToken, err := internal.FetchAccessToken(ctx, conf.ClientID, conf.ClientSecret)
-		if err != nil {
-			log.Printf("failed to fetch access token: %v", err)
-			continue
-		}
-		// Add the fetched access token into the context
-		ctx = ctxutil.WithAccessToken(ctx, accessToken)
+		// Run with the configuration current at the scheduled time, a reload during the run applies to the next one.
+		runCtx := ctxutil.WithAppConfig(ctx, d.current().conf)
 
 		// Retry and download the file again after the sleep period.
-		downloadAndRetry(ctx)
+		downloadBloomFilter(runCtx, d)
 
 		// Retry and upload the file again after the sleep period.
 		// TODO: @stevemilk - Deal with the filtered report file
-		// uploadAndRetry(ctx)
+		// uploadReport(runCtx, d)
 	}
 }
 
-// downloadAndRetry downloads the bloom filter file with a retry mechanism.
-func downloadAndRetry(ctx context.Context) {
-	err := retry.Do(
-		func() error {
-			// Attempt to download and store bloom filter
-			if err := internal.DownloadAndSaveBloomFilter(ctx, outputDir); err != nil {
-				return fmt.Errorf("download failed: %w", err)
-			}
-			return nil
-		},
-		retry.Delay(retryDelay),
-		retry.Attempts(retryAttempts),
-		retry.RetryIf(func(err error) bool {
-			// Check for context-related errors
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				log.Printf("Context-related error occurred: %v, will not retry", err)
-				return false
-			}
-			return true
-		}),
-	)
+// downloadBloomFilter downloads the bloom filter file once with the download retry policy and installs it into
+// every output directory, returning the result of each directory. A directory the filter cannot be installed into
+// keeps its previous filter until the next run.
+func downloadBloomFilter(ctx context.Context, api cipherowl.API) []internal.InstallResult {
+	dirs := outputDirs
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil {
+		dirs = conf.OutputDirs
+	}
+
+	var stagedPath string
+	err := retryConfig(ctx).DownloadPolicy().Do(ctx, func(ctx context.Context) error {
+		var err error
+		stagedPath, err = internal.DownloadBloomFilter(ctx, api)
+		return err
+	})
 	if err != nil {
-		log.Printf("Failed to download bloom filter after retries: %v", err)
-	} else {
-		log.Printf("Successfully downloaded bloom filter to %s", outputDir)
+		log.Printf("Failed to download bloom filter: %v", err)
+		return nil
+	}
+	defer os.Remove(stagedPath)
+
+	results := internal.InstallBloomFilter(stagedPath, dirs)
+	installed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Failed to install bloom filter into %s: %v", result.Dir, result.Err)
+			continue
+		}
+		installed++
+		log.Printf("Successfully installed bloom filter into %s", result.Dir)
+	}
+	if len(results) > 1 {
+		log.Printf("Installed bloom filter into %d of %d output directories", installed, len(results))
 	}
+
+	return results
 }
 
-// uploadAndRetry uploads the report file with a retry mechanism.
-func uploadAndRetry(ctx context.Context) {
-	err := retry.Do(
-		func() error {
-			// Attempt to upload bloom filter
-			if err := internal.UploadReportFile(ctx, filteredReportFilePath); err != nil {
-				return fmt.Errorf("upload failed: %w", err)
-			}
-			return nil
-		},
-		retry.Delay(retryDelay),
-		retry.Attempts(retryAttempts),
-		retry.RetryIf(func(err error) bool {
-			// Check for context-related errors
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				log.Printf("Context-related error occurred: %v, will not retry", err)
-				return false
-			}
-			return true
-		}),
-	)
+// uploadReport uploads the report file with the upload retry policy.
+func uploadReport(ctx context.Context, api cipherowl.API) {
+	reportFile := filteredReportFilePath
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil {
+		reportFile = conf.ReportFile
+	}
+	err := retryConfig(ctx).UploadPolicy().Do(ctx, func(ctx context.Context) error {
+		return internal.UploadReportFile(ctx, api, reportFile)
+	})
 	if err != nil {
-		log.Printf("Failed to upload report file after retries: %v", err)
+		log.Printf("Failed to upload report file: %v", err)
 	} else {
 		log.Printf("Successfully uploaded report file")
 	}
 }
+
+// retryConfig returns the retry configuration of the application, or the default one if there is none.
+func retryConfig(ctx context.Context) config.RetryConfig {
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil {
+		return conf.Retry
+	}
+
+	return config.DefaultRetryConfig()
+}
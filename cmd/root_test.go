@@ -2,128 +2,115 @@ package cmd
 
 import (
 	"context"
-	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 
-	"github.com/jarcoal/httpmock"
+	"github.com/spf13/cobra"
 
 	"github.com/piplabs/story-guardian/internal"
-	"github.com/piplabs/story-guardian/utils"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+	"github.com/piplabs/story-guardian/internal/config"
 	"github.com/piplabs/story-guardian/utils/ctxutil"
 )
 
-func Test_downloadAndRetry(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
+func Test_loadConfig_WithoutCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("report_file: "+filepath.Join(t.TempDir(), "filtered_txs.log")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prevConfigFile, prevOutputDirs, prevReportFile := configFile, outputDirs, filteredReportFilePath
+	t.Cleanup(func() {
+		configFile, outputDirs, filteredReportFilePath = prevConfigFile, prevOutputDirs, prevReportFile
+	})
+	configFile = path
+
+	// The report commands work on local files, they load the configuration without credentials.
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	if err := loadConfig(cmd); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if conf := ctxutil.GetAppConfig(cmd.Context()); conf == nil || conf.ValidateCredentials() == nil {
+		t.Errorf("loadConfig() stored %+v, want a configuration without credentials", conf)
+	}
+}
 
-	outputDir = utils.GetDefaultPath()
+func Test_downloadBloomFilter(t *testing.T) {
+	outputDirs = []string{t.TempDir()}
 
 	type args struct {
 		ctx context.Context
 	}
 	tests := []struct {
-		name string
-		args args
-		mock func()
+		name      string
+		args      args
+		wantCalls int
 	}{
 		{
 			name: "successful download and save",
 			args: args{
-				ctx: func() context.Context {
-					ctx := context.Background()
-					ctxutil.WithAccessToken(ctx, "test_access_token")
-					return ctx
-				}(),
-			},
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodGet, internal.BloomFilterFileURL,
-					httpmock.NewStringResponder(http.StatusOK, `{"presignedUrl": "test_presigned_url"}`))
-
-				httpmock.RegisterResponder(http.MethodGet, "test_presigned_url",
-					httpmock.NewStringResponder(http.StatusOK, "bloom_filter_data"))
+				ctx: context.Background(),
 			},
+			wantCalls: 2,
 		}, {
 			name: "ctx canceled",
 			args: args{
 				ctx: func() context.Context {
 					ctx, cancel := context.WithCancel(context.Background())
-					ctxutil.WithAccessToken(ctx, "test_access_token")
 					cancel()
 					return ctx
 				}(),
 			},
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodGet, internal.BloomFilterFileURL,
-					func(request *http.Request) (response *http.Response, err error) {
-						return nil, context.Canceled
-					})
-			},
+			wantCalls: 0,
 		},
 	}
 	for _, tt := range tests {
-		if tt.mock != nil {
-			tt.mock()
-		}
 		t.Run(tt.name, func(t *testing.T) {
-			downloadAndRetry(tt.args.ctx)
+			api := cipherowl.NewFake([]byte("bloom_filter_data"))
+			downloadBloomFilter(tt.args.ctx, api)
+
+			// A canceled context stops the retry loop before any further attempt.
+			if got := api.Calls(); got != tt.wantCalls {
+				t.Errorf("downloadBloomFilter() made %d API calls, want %d", got, tt.wantCalls)
+			}
 		})
 	}
 }
 
-func Test_uploadAndRetry(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
+func Test_uploadReport(t *testing.T) {
 	filteredReportFilePath = filepath.Join(os.TempDir(), "filtered_report.log")
 
 	type args struct {
 		ctx context.Context
 	}
 	tests := []struct {
-		name    string
-		args    args
-		mock    func()
-		wantErr bool
+		name        string
+		args        args
+		wantUploads int
+		wantErr     bool
 	}{
 		{
 			name: "successful upload",
 			args: args{
-				ctx: func() context.Context {
-					ctx := context.Background()
-					ctxutil.WithAccessToken(ctx, "test_access_token")
-					return ctx
-				}(),
+				ctx: context.Background(),
 			},
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodPost, internal.UploadFileURL,
-					httpmock.NewStringResponder(http.StatusOK, `{"status": "success"}`))
-			},
-			wantErr: false,
+			wantUploads: 1,
+			wantErr:     false,
 		}, {
 			name: "ctx canceled",
 			args: args{
 				ctx: func() context.Context {
 					ctx, cancel := context.WithCancel(context.Background())
-					ctxutil.WithAccessToken(ctx, "test_access_token")
 					cancel()
 					return ctx
 				}(),
 			},
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodPost, internal.UploadFileURL,
-					func(request *http.Request) (response *http.Response, err error) {
-						return nil, context.Canceled
-					})
-			},
-			wantErr: true,
+			wantUploads: 0,
+			wantErr:     true,
 		},
 	}
 	for _, tt := range tests {
-		if tt.mock != nil {
-			tt.mock()
-		}
 		t.Run(tt.name, func(t *testing.T) {
 			file, err := os.OpenFile(filteredReportFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 			if err != nil {
@@ -136,10 +123,41 @@ func Test_uploadAndRetry(t *testing.T) {
 				t.Fatal(err)
 			}
 			if tt.wantErr {
-				defer os.Remove(filteredReportFilePath)
+				defer os.RemoveAll(internal.PendingDir(filteredReportFilePath))
 			}
 
-			uploadAndRetry(tt.args.ctx)
+			api := cipherowl.NewFake(nil)
+			uploadReport(tt.args.ctx, api)
+
+			if got := len(api.Uploads()); got != tt.wantUploads {
+				t.Errorf("uploadReport() uploaded %d batches, want %d", got, tt.wantUploads)
+			}
 		})
 	}
 }
+
+func Test_downloadBloomFilter_OutputDirs(t *testing.T) {
+	root := t.TempDir()
+	blocked := filepath.Join(root, "blocked")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{filepath.Join(root, "archive"), blocked, filepath.Join(root, "rpc")}
+	conf := &config.AppConfig{OutputDirs: dirs, Retry: config.DefaultRetryConfig()}
+
+	api := cipherowl.NewFake([]byte("bloom_filter_data"))
+	results := downloadBloomFilter(ctxutil.WithAppConfig(context.Background(), conf), api)
+
+	// The filter is downloaded once, one presigned URL and one download, for every directory.
+	if got := api.Calls(); got != 2 {
+		t.Errorf("downloadBloomFilter() made %d API calls, want 2", got)
+	}
+	if len(results) != len(dirs) {
+		t.Fatalf("downloadBloomFilter() returned %d results, want %d", len(results), len(dirs))
+	}
+	for i, result := range results {
+		if result.Dir != dirs[i] || (result.Err != nil) != (result.Dir == blocked) {
+			t.Errorf("result %d = %+v, want only %s to fail", i, result, blocked)
+		}
+	}
+}
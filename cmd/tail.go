@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/config"
+	"github.com/piplabs/story-guardian/internal/tail"
+	"github.com/piplabs/story-guardian/utils/ctxutil"
+)
+
+// tailSettings are the settings the report tailer is built from.
+type tailSettings struct {
+	reportFile string
+	tail       config.TailConfig
+}
+
+// superviseTail runs the tail mode while it is enabled until the context is done. A reload changing the tail
+// settings or the report file restarts the tailer, which stages the lines read so far before it stops.
+func superviseTail(ctx context.Context, d *daemon) {
+	var (
+		stopTail func()
+		settings tailSettings
+	)
+	defer func() {
+		if stopTail != nil {
+			stopTail()
+		}
+	}()
+
+	for {
+		conf := d.current().conf
+		want := tailSettings{reportFile: conf.ReportFile, tail: conf.Tail}
+		if stopTail == nil || want != settings {
+			if stopTail != nil {
+				stopTail()
+				stopTail = nil
+			}
+			if conf.Tail.Enabled {
+				stopTail = runTail(ctxutil.WithAppConfig(ctx, conf), d)
+			}
+			settings = want
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.tailChanged:
+		}
+	}
+}
+
+// runTail starts the tail mode in the background, the returned function stops it and waits until it stopped.
+func runTail(ctx context.Context, d *daemon) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startTail(ctx, d)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// startTail follows the filtered report file and uploads new lines continuously until the context is done.
+// The tailer is built from the configuration of the context, the uploads use the current one of the daemon.
+func startTail(ctx context.Context, d *daemon) {
+	conf := ctxutil.GetAppConfig(ctx)
+	reportFile := conf.ReportFile
+
+	// The report directory must exist to be watched.
+	if err := os.MkdirAll(filepath.Dir(reportFile), 0755); err != nil {
+		log.Printf("startTail: failed to create report directory: %v", err)
+		return
+	}
+
+	tailer, err := tail.New(tail.Config{
+		Path:          reportFile,
+		OffsetPath:    conf.Tail.OffsetFile,
+		MaxBatchBytes: conf.Tail.BatchSize,
+		FlushInterval: conf.Tail.FlushInterval,
+		Stage: func(batch []byte) error {
+			return internal.StageReportBatch(reportFile, batch)
+		},
+		Upload: func(ctx context.Context) error {
+			return uploadTailBatches(ctx, d, reportFile)
+		},
+	})
+	if err != nil {
+		log.Printf("startTail: failed to initialize report tailer: %v", err)
+		return
+	}
+
+	log.Printf("startTail: following %s", reportFile)
+	if err := tailer.Run(ctx); err != nil {
+		log.Printf("startTail: report tailer stopped: %v", err)
+	}
+}
+
+// uploadTailBatches uploads the staged batches of the report file with the current configuration of the daemon,
+// so a reload of the redaction policy or the archive settings applies to the next upload without a restart of
+// the tailer.
+func uploadTailBatches(ctx context.Context, d *daemon, reportFile string) error {
+	return internal.UploadPendingBatches(ctxutil.WithAppConfig(ctx, d.current().conf), d, reportFile)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+)
+
+func Test_uploadTailBatches_Reload(t *testing.T) {
+	const sender = "0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58"
+	conf := testAppConfig(t)
+	conf.ReportFile = filepath.Join(t.TempDir(), "filtered_txs.log")
+	d, err := newDaemon(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := cipherowl.NewFake(nil)
+	state := *d.current()
+	state.api = api
+	d.state.Store(&state)
+
+	// upload stages a report line and uploads it like the tailer does, returning the uploaded body.
+	upload := func(nonce int) []byte {
+		t.Helper()
+		line := fmt.Sprintf("timestamp: 2024-11-14T17:14:05+08:00, filtered_address: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, "+
+			"tx_hash: 0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85, type: 0, from: %s, "+
+			"to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, value: 0, nonce: %d, gas: 0, gas_price: 0\n", sender, nonce)
+		if err := internal.StageReportBatch(conf.ReportFile, []byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := uploadTailBatches(context.Background(), d, conf.ReportFile); err != nil {
+			t.Fatal(err)
+		}
+		uploads := api.Uploads()
+		if len(uploads) != nonce+1 {
+			t.Fatalf("uploaded %d batches, want %d", len(uploads), nonce+1)
+		}
+
+		return uploads[nonce].Body
+	}
+
+	if body := upload(0); !bytes.Contains(body, []byte(sender)) {
+		t.Errorf("upload before the reload = %q, want the sender", body)
+	}
+
+	// A reload tightening the redaction policy applies to the next upload of the running tailer.
+	redacted := *conf
+	redacted.Redaction.Fields = map[string]string{"from": "drop"}
+	if err := d.reload(&redacted); err != nil {
+		t.Fatal(err)
+	}
+	if body := upload(1); bytes.Contains(body, []byte(sender)) {
+		t.Errorf("upload after the reload = %q, want the sender dropped", body)
+	}
+}
@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// indexFileName is the name of the JSON lines file recording every archived upload.
+	indexFileName = "index.jsonl"
+	// dateLayout is the layout of the dated sub-directories of the archive.
+	dateLayout = "2006-01-02"
+	// archiveExt is appended to the name of every compressed report.
+	archiveExt = ".gz"
+)
+
+// Entry describes an archived report in the upload index.
+type Entry struct {
+	// File is the path of the compressed report, relative to the archive directory.
+	File string `json:"file"`
+	// BatchID is the client-generated ID the report was uploaded with.
+	BatchID string `json:"batch_id,omitempty"`
+	// ReceiptID is the upload ID returned by the CipherOwl server, if any.
+	ReceiptID string `json:"receipt_id,omitempty"`
+	// UploadedAt is the time the report was accepted by the CipherOwl server.
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Status is the HTTP status code returned by the upload request.
+	Status int `json:"status"`
+	// Size is the size in bytes of the compressed report.
+	Size int64 `json:"size"`
+}
+
+// Archiver keeps compressed copies of uploaded reports and enforces the retention policy.
+type Archiver struct {
+	dir     string
+	maxAge  time.Duration
+	maxSize int64
+	now     func() time.Time
+}
+
+// New creates an Archiver storing reports under dir. A zero maxAge or maxSize disables the respective limit.
+func New(dir string, maxAge time.Duration, maxSize int64) *Archiver {
+	return &Archiver{
+		dir:     dir,
+		maxAge:  maxAge,
+		maxSize: maxSize,
+		now:     time.Now,
+	}
+}
+
+// Dir returns the root directory of the archive.
+func (a *Archiver) Dir() string {
+	return a.dir
+}
+
+// Store compresses the report at srcPath into the dated archive directory, records it in the index
+// and prunes the archive according to the retention policy. The upload details are taken from entry,
+// a zero UploadedAt defaults to the current time.
+func (a *Archiver) Store(srcPath string, entry Entry) (Entry, error) {
+	uploadedAt := entry.UploadedAt.UTC()
+	if entry.UploadedAt.IsZero() {
+		uploadedAt = a.now().UTC()
+	}
+
+	dateDir := uploadedAt.Format(dateLayout)
+	if err := os.MkdirAll(filepath.Join(a.dir, dateDir), 0755); err != nil {
+		return Entry{}, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(srcPath), filepath.Ext(srcPath))
+	name := fmt.Sprintf("%s-%s%s%s", base, uploadedAt.Format("150405.000000000"), filepath.Ext(srcPath), archiveExt)
+	relPath := filepath.Join(dateDir, name)
+
+	size, err := compressFile(srcPath, filepath.Join(a.dir, relPath))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry.File = relPath
+	entry.UploadedAt = uploadedAt
+	entry.Size = size
+	if err := a.appendIndex(entry); err != nil {
+		return Entry{}, err
+	}
+
+	return entry, a.Prune()
+}
+
+// Entries returns the archived reports recorded in the index, oldest first.
+func (a *Archiver) Entries() ([]Entry, error) {
+	file, err := os.Open(filepath.Join(a.dir, indexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse archive index entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UploadedAt.Before(entries[j].UploadedAt)
+	})
+
+	return entries, nil
+}
+
+// Open returns a reader over the decompressed content of an archived report.
+func (a *Archiver) Open(entry Entry) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(a.dir, entry.File))
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &gzipReadCloser{Reader: gz, file: file}, nil
+}
+
+// Prune removes archived reports older than the maximum age and then the oldest reports
+// until the archive fits into the maximum size.
+func (a *Archiver) Prune() error {
+	entries, err := a.Entries()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	cutoff := a.now().Add(-a.maxAge)
+	kept := entries[:0:0]
+	for i, entry := range entries {
+		expired := a.maxAge > 0 && entry.UploadedAt.Before(cutoff)
+		oversized := a.maxSize > 0 && total > a.maxSize
+		if !expired && !oversized {
+			kept = append(kept, entries[i:]...)
+			break
+		}
+
+		if err := os.Remove(filepath.Join(a.dir, entry.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		// Drop the dated directory once its last report is gone, ignoring the error if it still has content.
+		_ = os.Remove(filepath.Dir(filepath.Join(a.dir, entry.File)))
+		total -= entry.Size
+	}
+
+	if len(kept) == len(entries) {
+		return nil
+	}
+
+	return a.writeIndex(kept)
+}
+
+// appendIndex appends a single entry to the upload index.
+func (a *Archiver) appendIndex(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(a.dir, indexFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// writeIndex atomically replaces the upload index with the given entries.
+func (a *Archiver) writeIndex(entries []Entry) error {
+	tmp, err := os.CreateTemp(a.dir, indexFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(a.dir, indexFileName))
+}
+
+// compressFile writes a gzip compressed copy of src to dst and returns the compressed size.
+func compressFile(src, dst string) (int64, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(dstFile)
+	gz.Name = filepath.Base(src)
+	if _, err := io.Copy(gz, srcFile); err != nil {
+		dstFile.Close()
+		os.Remove(dst)
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		dstFile.Close()
+		os.Remove(dst)
+		return 0, err
+	}
+	if err := dstFile.Close(); err != nil {
+		os.Remove(dst)
+		return 0, err
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying file.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *gzipReadCloser) Close() error {
+	return errors.Join(r.Reader.Close(), r.file.Close())
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testReportLine = "timestamp: 2024-11-14T17:14:05+08:00, filtered_address: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, tx_hash: 0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85, type: 0, from: 0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58, to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, value: 0, nonce: 0, gas: 0, gas_price: 0"
+
+func writeReport(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "filtered_report.log")
+	if err := os.WriteFile(path, []byte(testReportLine+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestArchiver_Store(t *testing.T) {
+	archiveDir := t.TempDir()
+	reportPath := writeReport(t, t.TempDir())
+
+	archiver := New(archiveDir, 0, 0)
+	entry, err := archiver.Store(reportPath, Entry{BatchID: "test_batch_id", Status: http.StatusOK})
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if entry.Status != http.StatusOK || entry.BatchID != "test_batch_id" {
+		t.Errorf("Store() = %+v, want the upload details to be kept", entry)
+	}
+	if filepath.Dir(entry.File) != entry.UploadedAt.Format(dateLayout) {
+		t.Errorf("Store() file = %v, want it in the dated directory", entry.File)
+	}
+
+	entries, err := archiver.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].File != entry.File {
+		t.Fatalf("Entries() = %v, want [%v]", entries, entry)
+	}
+
+	r, err := archiver.Open(entries[0])
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testReportLine+"\n" {
+		t.Errorf("Open() content = %q, want %q", content, testReportLine+"\n")
+	}
+}
+
+func TestArchiver_Prune(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		maxSize   func(entrySize int64) int64
+		advance   time.Duration
+		wantCount int
+	}{
+		{
+			name:      "no limits keeps everything",
+			advance:   time.Hour,
+			wantCount: 3,
+		},
+		{
+			name:      "expired reports are removed",
+			maxAge:    36 * time.Hour,
+			advance:   24 * time.Hour,
+			wantCount: 2,
+		},
+		{
+			name:      "oldest reports are removed to fit the size limit",
+			maxSize:   func(entrySize int64) int64 { return entrySize },
+			advance:   time.Hour,
+			wantCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveDir := t.TempDir()
+			srcDir := t.TempDir()
+
+			now := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+			archiver := New(archiveDir, tt.maxAge, 0)
+			archiver.now = func() time.Time { return now }
+
+			var last Entry
+			for range 3 {
+				entry, err := archiver.Store(writeReport(t, srcDir), Entry{Status: http.StatusOK})
+				if err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+				last = entry
+				now = now.Add(tt.advance)
+			}
+			if tt.maxSize != nil {
+				archiver.maxSize = tt.maxSize(last.Size)
+				if err := archiver.Prune(); err != nil {
+					t.Fatalf("Prune() error = %v", err)
+				}
+			}
+
+			entries, err := archiver.Entries()
+			if err != nil {
+				t.Fatalf("Entries() error = %v", err)
+			}
+			if len(entries) != tt.wantCount {
+				t.Fatalf("Entries() count = %v, want %v", len(entries), tt.wantCount)
+			}
+			if entries[len(entries)-1].File != last.File {
+				t.Errorf("latest entry = %v, want %v", entries[len(entries)-1].File, last.File)
+			}
+			for _, entry := range entries {
+				if _, err := os.Stat(filepath.Join(archiveDir, entry.File)); err != nil {
+					t.Errorf("archived file %v is missing: %v", entry.File, err)
+				}
+			}
+		})
+	}
+}
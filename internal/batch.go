@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+)
+
+const (
+	// pendingDirName is the directory, next to the report file, holding batches waiting for upload.
+	pendingDirName = "pending"
+	// batchExt is the extension of a pending report batch.
+	batchExt = ".log"
+	// receiptExt is the extension of the upload receipt stored next to a batch.
+	receiptExt = ".receipt.json"
+	// batchIDLength is the number of bytes of the content hash used as batch ID.
+	batchIDLength = 16
+)
+
+// PendingDir returns the directory holding the pending batches of the given report file.
+func PendingDir(reportFilePath string) string {
+	return filepath.Join(filepath.Dir(reportFilePath), pendingDirName)
+}
+
+// batchID derives a stable batch ID from the content of a report batch.
+func batchID(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:batchIDLength]), nil
+}
+
+// batchPath returns the path of a pending batch with the given ID.
+func batchPath(pendingDir, id string) string {
+	return filepath.Join(pendingDir, id+batchExt)
+}
+
+// receiptPath returns the path of the receipt stored next to a pending batch.
+func receiptPath(batchFilePath string) string {
+	return strings.TrimSuffix(batchFilePath, batchExt) + receiptExt
+}
+
+// batchIDFromPath extracts the batch ID from the path of a pending batch.
+func batchIDFromPath(batchFilePath string) string {
+	return strings.TrimSuffix(filepath.Base(batchFilePath), batchExt)
+}
+
+// rotateReportFile moves the report file into the pending directory as a new batch and returns its path.
+// An empty or missing report file yields an empty path.
+func rotateReportFile(reportFilePath, pendingDir string) (string, error) {
+	file, err := os.Open(reportFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+	if info.Size() == 0 {
+		file.Close()
+		return "", nil
+	}
+
+	id, err := batchID(file)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(pendingDir, 0755); err != nil {
+		return "", err
+	}
+
+	path := batchPath(pendingDir, id)
+	if _, err := os.Stat(path); err == nil {
+		// The same content is already pending, drop the duplicate.
+		return path, os.Remove(reportFilePath)
+	}
+
+	return path, os.Rename(reportFilePath, path)
+}
+
+// StageReportBatch durably stores report lines as a pending batch of the given report file.
+// Staging the same content twice yields the same batch.
+func StageReportBatch(reportFilePath string, data []byte) error {
+	id, err := batchID(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	pendingDir := PendingDir(reportFilePath)
+	if err := os.MkdirAll(pendingDir, 0755); err != nil {
+		return err
+	}
+
+	path := batchPath(pendingDir, id)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(pendingDir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// PendingBatchFiles lists the pending batches of the given report file, oldest first.
+func PendingBatchFiles(reportFilePath string) ([]string, error) {
+	return pendingBatches(PendingDir(reportFilePath))
+}
+
+// pendingBatches lists the pending batches, oldest first.
+func pendingBatches(pendingDir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(pendingDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type batch struct {
+		path    string
+		modTime time.Time
+	}
+	var batches []batch
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != batchExt {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch{
+			path:    filepath.Join(pendingDir, dirEntry.Name()),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].modTime.Before(batches[j].modTime)
+	})
+
+	paths := make([]string, 0, len(batches))
+	for _, b := range batches {
+		paths = append(paths, b.path)
+	}
+
+	return paths, nil
+}
+
+// readReceipt loads the receipt stored next to a batch, returning nil if the batch was never uploaded.
+func readReceipt(batchFilePath string) (*cipherowl.UploadReceipt, error) {
+	data, err := os.ReadFile(receiptPath(batchFilePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt cipherowl.UploadReceipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+// writeReceipt atomically stores the receipt next to its batch.
+func writeReceipt(batchFilePath string, receipt *cipherowl.UploadReceipt) error {
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := receiptPath(batchFilePath)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,297 @@
+package cipherowl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+
+	"github.com/piplabs/story-guardian/internal/config"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+	"github.com/piplabs/story-guardian/internal/pkg/retrypolicy"
+)
+
+const (
+	// maxUploadResponseSize limits how much of an upload response body is kept in the receipt.
+	maxUploadResponseSize = 1 << 20
+)
+
+// Endpoint names of the CipherOwl requests, which have a circuit breaker each.
+const (
+	EndpointToken    = "cipherowl token"
+	EndpointFilter   = "cipherowl filter"
+	EndpointDownload = "cipherowl download"
+	EndpointUpload   = "cipherowl upload"
+)
+
+// API is the part of the CipherOwl API used by the downloader and the uploader.
+type API interface {
+	// FetchBloomFilterURL returns the presigned URL of the current bloom filter file.
+	FetchBloomFilterURL(ctx context.Context) (string, error)
+	// DownloadFile downloads the file behind a presigned URL, the caller closes the returned body.
+	DownloadFile(ctx context.Context, url string) (io.ReadCloser, error)
+	// UploadReport uploads a batch of the filtered report. The batch ID is sent as idempotency key,
+	// so a retried upload of the same batch is not processed twice.
+	UploadReport(ctx context.Context, batchID string, body []byte, contentType string) (*UploadReceipt, error)
+}
+
+// TokenSource provides access tokens for the CipherOwl API.
+type TokenSource interface {
+	// Token returns a valid access token, fetching a new one if necessary.
+	Token(ctx context.Context) (string, error)
+	// Invalidate drops the given token after the server rejected it.
+	Invalidate(token string)
+}
+
+// oAuthTokenRequest is the payload structure for obtaining an access token.
+type oAuthTokenRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Audience     string `json:"audience"`
+	GrantType    string `json:"grant_type"`
+}
+
+// oAuthTokenResponse represents the response structure for the access token request.
+type oAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// presignedURLResponse represents the response structure for the bloom filter file's presigned URL request.
+type presignedURLResponse struct {
+	PresignedURL string `json:"presignedUrl"`
+}
+
+// Client talks to the CipherOwl API. It is safe for concurrent use.
+type Client struct {
+	api         config.APIConfig
+	httpClient  *httpclient.Client
+	tokens      TokenSource
+	logger      *log.Logger
+	credentials Credentials
+	tokenRetry  retrypolicy.Policy
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIConfig sets the endpoints and the audience of the CipherOwl API.
+func WithAPIConfig(api config.APIConfig) Option {
+	return func(c *Client) {
+		c.api = api
+	}
+}
+
+// WithBaseURL sets the base URL the API paths are resolved against.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.api.BaseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests and file downloads.
+func WithHTTPClient(httpClient *httpclient.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTokenSource sets the source of the access tokens, overriding WithCredentials.
+func WithTokenSource(tokens TokenSource) Option {
+	return func(c *Client) {
+		c.tokens = tokens
+	}
+}
+
+// WithCredentials sets the client credentials access tokens are fetched with.
+func WithCredentials(clientID, clientSecret string) Option {
+	return WithCredentialsSource(StaticCredentials{ClientID: clientID, ClientSecret: clientSecret})
+}
+
+// WithCredentialsSource sets the source of the client credentials, such as FileCredentials for rotated secrets.
+func WithCredentialsSource(credentials Credentials) Option {
+	return func(c *Client) {
+		c.credentials = credentials
+	}
+}
+
+// WithTokenRetryPolicy sets how failed access token fetches are retried, they are not retried by default.
+func WithTokenRetryPolicy(policy retrypolicy.Policy) Option {
+	return func(c *Client) {
+		c.tokenRetry = policy
+	}
+}
+
+// WithLogger sets the logger of the client.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// NewClient creates a Client for the production CipherOwl API, adjusted by the given options.
+// Without a token source, access tokens are fetched and cached with the configured credentials.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		api: config.DefaultAPIConfig(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = httpclient.DefaultClient()
+	}
+	if c.logger == nil {
+		c.logger = log.Default()
+	}
+	if c.credentials == nil {
+		c.credentials = StaticCredentials{}
+	}
+	if c.tokens == nil {
+		c.tokens = NewTokenSource(c, c.credentials)
+	}
+
+	return c
+}
+
+// fetchAccessTokenWithRetry fetches an access token with the token retry policy. Once that policy gave up, the
+// error is marked permanent, so the retry policy of the download or upload needing the token does not repeat
+// the token retries.
+func (c *Client) fetchAccessTokenWithRetry(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+	var tokenResponse *oAuthTokenResponse
+	err := c.tokenRetry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		tokenResponse, err = c.fetchAccessToken(ctx, clientID, clientSecret)
+		return err
+	})
+	if err != nil && c.tokenRetry.Attempts > 1 {
+		return nil, retrypolicy.Permanent(err)
+	}
+
+	return tokenResponse, err
+}
+
+// fetchAccessToken requests an OAuth access token using client credentials and returns the full token response.
+func (c *Client) fetchAccessToken(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+	requestPayload := oAuthTokenRequest{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Audience:     c.api.Audience,
+		GrantType:    "client_credentials",
+	}
+
+	// Serialize the request payload
+	jsonData, err := json.Marshal(requestPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{
+		httpclient.ContentTypeHeader: httpclient.ContentTypeJSON,
+	}
+	// Send POST request
+	resp, err := c.httpClient.Do(httpclient.WithEndpoint(ctx, EndpointToken), http.MethodPost, c.api.TokenEndpoint(), bytes.NewReader(jsonData), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Decode response JSON
+	var tokenResponse oAuthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse, nil
+}
+
+// FetchBloomFilterURL retrieves the presigned URL for the bloom filter file.
+func (c *Client) FetchBloomFilterURL(ctx context.Context) (string, error) {
+	header := map[string]string{
+		httpclient.ContentTypeHeader: httpclient.ContentTypeJSON,
+	}
+
+	// Perform the HTTP request
+	resp, err := c.doAuthorized(httpclient.WithEndpoint(ctx, EndpointFilter), http.MethodGet, c.api.FilterEndpoint(), nil, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Decode response JSON
+	var urlResp presignedURLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&urlResp); err != nil {
+		return "", err
+	}
+
+	return urlResp.PresignedURL, nil
+}
+
+// DownloadFile downloads the file behind a presigned URL. No access token is sent, the URL carries its own signature.
+func (c *Client) DownloadFile(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := c.httpClient.Do(httpclient.WithEndpoint(ctx, EndpointDownload), http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// UploadReport uploads a batch of the filtered report to the CipherOwl server and returns the upload receipt.
+func (c *Client) UploadReport(ctx context.Context, batchID string, body []byte, contentType string) (*UploadReceipt, error) {
+	header := map[string]string{
+		httpclient.ContentTypeHeader:    contentType,
+		httpclient.IdempotencyKeyHeader: batchID,
+	}
+
+	// Perform the HTTP request
+	resp, err := c.doAuthorized(httpclient.WithEndpoint(ctx, EndpointUpload), http.MethodPost, c.api.UploadEndpoint(), body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxUploadResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return newUploadReceipt(batchID, resp.StatusCode, respBody), nil
+}
+
+// doAuthorized performs an API request with a bearer token. If the server rejects the token,
+// a fresh token is fetched and the request is retried once.
+func (c *Client) doAuthorized(ctx context.Context, method, url string, body []byte, header map[string]string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+
+		requestHeader := maps.Clone(header)
+		requestHeader[httpclient.AuthorizationHeader] = "Bearer " + token
+
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		resp, err := c.httpClient.Do(ctx, method, url, reqBody, requestHeader)
+		var apiErr *httpclient.APIError
+		if errors.As(err, &apiErr) && apiErr.IsUnauthorized() && attempt == 0 {
+			// The token expired or was revoked early, drop it and try once more with a new one.
+			c.logger.Printf("access token rejected by %s, fetching a new one", apiErr.Endpoint)
+			c.tokens.Invalidate(token)
+			continue
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,238 @@
+package cipherowl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// staticTokenSource always returns the same token.
+type staticTokenSource string
+
+func (s staticTokenSource) Token(context.Context) (string, error) { return string(s), nil }
+func (s staticTokenSource) Invalidate(string)                     {}
+
+// newTestClient starts a server with the given handler and returns a client talking to it.
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithBaseURL(server.URL), WithTokenSource(staticTokenSource("test_access_token"))}, opts...)
+	return NewClient(opts...)
+}
+
+func TestClient_fetchAccessToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "successful fetch access token",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var req oAuthTokenRequest
+				if r.URL.Path != "/oauth/token" || json.NewDecoder(r.Body).Decode(&req) != nil ||
+					req.ClientID != "test_client_id" || req.Audience != "svc.cipherowl.ai" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				io.WriteString(w, `{"access_token": "test_access_token", "expires_in": 86400}`)
+			},
+			want:    "test_access_token",
+			wantErr: false,
+		},
+		{
+			name: "failed fetch access token",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error": "invalid_client"}`)
+			},
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+
+			got, err := client.fetchAccessToken(context.Background(), "test_client_id", "test_client_secret")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fetchAccessToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.AccessToken != tt.want {
+				t.Errorf("fetchAccessToken() got = %v, want %v", got.AccessToken, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_FetchBloomFilterURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "successful fetch bloom filter presigned URL",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/bloom-filter/file/1" || r.Header.Get(httpclient.AuthorizationHeader) != "Bearer test_access_token" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				io.WriteString(w, `{"presignedUrl": "test_presigned_url"}`)
+			},
+			want:    "test_presigned_url",
+			wantErr: false,
+		},
+		{
+			name: "failed fetch bloom filter presigned URL",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `{"error": "access_denied"}`)
+			},
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+
+			got, err := client.FetchBloomFilterURL(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FetchBloomFilterURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FetchBloomFilterURL() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_DownloadFile(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The presigned URL carries its own signature, the access token must not leak to the storage host.
+		if r.Header.Get(httpclient.AuthorizationHeader) != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "bloom_filter_data")
+	})
+
+	body, err := client.DownloadFile(context.Background(), client.api.BaseURL+"/bloom_filter.gob?X-Amz-Signature=abc")
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "bloom_filter_data" {
+		t.Errorf("DownloadFile() content = %q, want %q", content, "bloom_filter_data")
+	}
+}
+
+func TestClient_DownloadFile_SharesBreaker(t *testing.T) {
+	breakers := circuitbreaker.NewSet(circuitbreaker.Config{FailureThreshold: 2, Cooldown: time.Hour}, nil)
+	conf := httpclient.DefaultConfig()
+	conf.Middlewares = []httpclient.Middleware{httpclient.CircuitBreaker(breakers)}
+	httpClient, err := httpclient.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithHTTPClient(httpClient))
+
+	// Every download has its own presigned URL, failures still add up on the breaker of the download endpoint.
+	for i := range 3 {
+		url := fmt.Sprintf("%s/filters/%d.gob?X-Amz-Signature=%d", client.api.BaseURL, i, i)
+		if _, err := client.DownloadFile(context.Background(), url); err == nil {
+			t.Fatalf("DownloadFile() error = nil, want an error")
+		}
+	}
+	if got := breakers.Get(EndpointDownload).State(); got != circuitbreaker.Open {
+		t.Errorf("download breaker state = %s, want %s", got, circuitbreaker.Open)
+	}
+}
+
+func TestClient_UploadReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    *UploadReceipt
+		wantErr bool
+	}{
+		{
+			name: "successful upload report file",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/upload/report/v1" || r.Header.Get(httpclient.IdempotencyKeyHeader) != "test_batch_id" {
+					w.WriteHeader(http.StatusBadRequest)
+					io.WriteString(w, `{"error": "missing_idempotency_key"}`)
+					return
+				}
+				io.WriteString(w, `{"status": "success", "id": "test_receipt_id"}`)
+			},
+			want: &UploadReceipt{
+				BatchID:    "test_batch_id",
+				StatusCode: http.StatusOK,
+				Status:     "success",
+				ReceiptID:  "test_receipt_id",
+			},
+			wantErr: false,
+		},
+		{
+			name: "successful upload without response body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			want: &UploadReceipt{
+				BatchID:    "test_batch_id",
+				StatusCode: http.StatusAccepted,
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed upload report file",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error": "invalid_request"}`)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+
+			got, err := client.UploadReport(context.Background(), "test_batch_id", []byte("test_report_file"), "text/plain")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UploadReport() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.BatchID != tt.want.BatchID || got.StatusCode != tt.want.StatusCode ||
+				got.Status != tt.want.Status || got.ReceiptID != tt.want.ReceiptID {
+				t.Errorf("UploadReport() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package cipherowl
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials provides the client credentials access tokens are fetched with.
+type Credentials interface {
+	// Credentials returns the current client ID and secret.
+	Credentials() (clientID, clientSecret string, err error)
+}
+
+// StaticCredentials are client credentials that never change.
+type StaticCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// Credentials implements Credentials.
+func (c StaticCredentials) Credentials() (string, string, error) {
+	return c.ClientID, c.ClientSecret, nil
+}
+
+// FileCredentials reads the client ID and secret from files, such as Docker or Kubernetes secret mounts,
+// and re-reads a file once it changes, so a rotated secret is used without a restart. A value without
+// file is used as is. It is safe for concurrent use.
+type FileCredentials struct {
+	clientID     *credentialFile
+	clientSecret *credentialFile
+}
+
+// NewFileCredentials creates FileCredentials. A non-empty file path takes precedence over the respective value.
+func NewFileCredentials(clientID, clientIDFile, clientSecret, clientSecretFile string) *FileCredentials {
+	return &FileCredentials{
+		clientID:     &credentialFile{name: "client ID", path: clientIDFile, value: clientID},
+		clientSecret: &credentialFile{name: "client secret", path: clientSecretFile, value: clientSecret},
+	}
+}
+
+// Credentials implements Credentials.
+func (c *FileCredentials) Credentials() (string, string, error) {
+	clientID, err := c.clientID.read()
+	if err != nil {
+		return "", "", err
+	}
+	clientSecret, err := c.clientSecret.read()
+	if err != nil {
+		return "", "", err
+	}
+
+	return clientID, clientSecret, nil
+}
+
+// credentialFile is a single credential, read from a file if a path is set.
+type credentialFile struct {
+	name string
+	path string
+
+	mu      sync.Mutex
+	value   string
+	modTime time.Time
+	size    int64
+}
+
+// read returns the credential, reading the file again if its modification time or size changed.
+func (f *credentialFile) read() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.path == "" {
+		return f.value, nil
+	}
+
+	// Stat follows the symlinks Kubernetes swaps when it updates a secret mount.
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s file: %w", f.name, err)
+	}
+	if f.value != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value, nil
+	}
+
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s file: %w", f.name, err)
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("%s file %s is empty", f.name, f.path)
+	}
+
+	if f.value != "" && f.value != value {
+		log.Printf("Reloaded %s from %s", f.name, f.path)
+	}
+	f.value = value
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return f.value, nil
+}
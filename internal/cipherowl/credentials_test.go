@@ -0,0 +1,113 @@
+package cipherowl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCredentialFile writes content to path with the given modification time.
+func writeCredentialFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileCredentials_Credentials(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "client_secret")
+	modTime := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		idFile     string
+		secretFile string
+		mock       func()
+		wantID     string
+		wantSecret string
+		wantErr    bool
+	}{
+		{
+			name:       "values without files",
+			wantID:     "env_client_id",
+			wantSecret: "env_client_secret",
+		},
+		{
+			name:       "file takes precedence and is trimmed",
+			secretFile: secretFile,
+			mock: func() {
+				writeCredentialFile(t, secretFile, "file_client_secret\n", modTime)
+			},
+			wantID:     "env_client_id",
+			wantSecret: "file_client_secret",
+		},
+		{
+			name:    "missing file",
+			idFile:  filepath.Join(dir, "missing"),
+			wantErr: true,
+		},
+		{
+			name:       "empty file",
+			secretFile: secretFile,
+			mock: func() {
+				writeCredentialFile(t, secretFile, " \n", modTime)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			credentials := NewFileCredentials("env_client_id", tt.idFile, "env_client_secret", tt.secretFile)
+			gotID, gotSecret, err := credentials.Credentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotID != tt.wantID || gotSecret != tt.wantSecret {
+				t.Errorf("Credentials() = %q, %q, want %q, %q", gotID, gotSecret, tt.wantID, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestFileCredentials_Rotation(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "client_secret")
+	modTime := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+	writeCredentialFile(t, secretFile, "old_secret", modTime)
+
+	var fetchedWith []string
+	source := NewTokenSource(NewClient(), NewFileCredentials("test_client_id", "", "", secretFile))
+	source.fetch = func(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+		fetchedWith = append(fetchedWith, clientSecret)
+		return &oAuthTokenResponse{AccessToken: clientSecret + "_token", ExpiresIn: 3600}, nil
+	}
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret is rotated, the next token fetch uses it without restarting.
+	writeCredentialFile(t, secretFile, "new_secret", modTime.Add(time.Minute))
+	source.Invalidate(token)
+	if token, err = source.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "new_secret_token" {
+		t.Errorf("Token() = %v, want new_secret_token", token)
+	}
+	if len(fetchedWith) != 2 || fetchedWith[0] != "old_secret" || fetchedWith[1] != "new_secret" {
+		t.Errorf("tokens fetched with secrets %v, want [old_secret new_secret]", fetchedWith)
+	}
+}
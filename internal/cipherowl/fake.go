@@ -0,0 +1,121 @@
+package cipherowl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// FakePresignedURL is the presigned URL handed out by Fake.
+const FakePresignedURL = "fake://bloom-filter"
+
+// FakeUpload is a report batch received by Fake.
+type FakeUpload struct {
+	BatchID     string
+	ContentType string
+	Body        []byte
+}
+
+// Fake is an in-memory implementation of API for tests. Like the CipherOwl server, it accepts
+// an upload only once per batch ID. The error fields make the respective calls fail.
+type Fake struct {
+	mu sync.Mutex
+
+	// Filter is the content of the bloom filter file.
+	Filter []byte
+	// FetchErr, DownloadErr and UploadErr are returned by the respective calls if set.
+	FetchErr    error
+	DownloadErr error
+	UploadErr   error
+
+	uploads []FakeUpload
+	calls   int
+}
+
+var _ API = (*Fake)(nil)
+
+// NewFake creates a Fake serving the given bloom filter content.
+func NewFake(filter []byte) *Fake {
+	return &Fake{Filter: filter}
+}
+
+// FetchBloomFilterURL implements API.
+func (f *Fake) FetchBloomFilterURL(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if f.FetchErr != nil {
+		return "", f.FetchErr
+	}
+
+	return FakePresignedURL, nil
+}
+
+// DownloadFile implements API.
+func (f *Fake) DownloadFile(ctx context.Context, url string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.DownloadErr != nil {
+		return nil, f.DownloadErr
+	}
+	if url != FakePresignedURL {
+		return nil, fmt.Errorf("unknown presigned URL %q", url)
+	}
+
+	return io.NopCloser(bytes.NewReader(f.Filter)), nil
+}
+
+// UploadReport implements API.
+func (f *Fake) UploadReport(ctx context.Context, batchID string, body []byte, contentType string) (*UploadReceipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.UploadErr != nil {
+		return nil, f.UploadErr
+	}
+
+	status := "duplicate"
+	if !slices.ContainsFunc(f.uploads, func(u FakeUpload) bool { return u.BatchID == batchID }) {
+		status = "success"
+		f.uploads = append(f.uploads, FakeUpload{
+			BatchID:     batchID,
+			ContentType: contentType,
+			Body:        bytes.Clone(body),
+		})
+	}
+
+	return newUploadReceipt(batchID, http.StatusOK, []byte(fmt.Sprintf(`{"status": %q, "id": %q}`, status, batchID))), nil
+}
+
+// Uploads returns the accepted report batches in the order they were received.
+func (f *Fake) Uploads() []FakeUpload {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.uploads)
+}
+
+// Calls returns the number of API calls made, including failed ones.
+func (f *Fake) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls
+}
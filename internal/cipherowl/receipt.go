@@ -0,0 +1,49 @@
+package cipherowl
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UploadReceipt records the server's answer to the upload of a report batch.
+type UploadReceipt struct {
+	BatchID    string          `json:"batch_id"`
+	StatusCode int             `json:"status_code"`
+	Status     string          `json:"status,omitempty"`
+	ReceiptID  string          `json:"receipt_id,omitempty"`
+	UploadedAt time.Time       `json:"uploaded_at"`
+	Response   json.RawMessage `json:"response,omitempty"`
+}
+
+// uploadResponse lists the fields of an upload response body that are copied into the receipt.
+type uploadResponse struct {
+	Status    string `json:"status"`
+	ID        string `json:"id"`
+	ReceiptID string `json:"receipt_id"`
+	UploadID  string `json:"upload_id"`
+}
+
+// newUploadReceipt builds a receipt from the status code and the raw body of an upload response.
+func newUploadReceipt(batchID string, statusCode int, body []byte) *UploadReceipt {
+	receipt := &UploadReceipt{
+		BatchID:    batchID,
+		StatusCode: statusCode,
+		UploadedAt: time.Now().UTC(),
+	}
+
+	// The body is optional, only a JSON object is kept in the receipt.
+	var resp uploadResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return receipt
+	}
+	receipt.Response = json.RawMessage(body)
+	receipt.Status = resp.Status
+	for _, id := range []string{resp.ReceiptID, resp.UploadID, resp.ID} {
+		if id != "" {
+			receipt.ReceiptID = id
+			break
+		}
+	}
+
+	return receipt
+}
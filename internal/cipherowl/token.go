@@ -0,0 +1,113 @@
+package cipherowl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultTokenRefreshSkew is how long before its expiry a cached access token is refreshed. Short-lived tokens are
+// refreshed after half their lifetime instead.
+const defaultTokenRefreshSkew = time.Minute
+
+// CachingTokenSource caches the CipherOwl access token and refreshes it shortly before it expires.
+// It is safe for concurrent use, concurrent callers share a single token fetch.
+type CachingTokenSource struct {
+	credentials Credentials
+	refreshSkew time.Duration
+	now         func() time.Time
+	fetch       func(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error)
+
+	mu    sync.Mutex
+	token string
+	// refreshAt is when the token is refreshed, shortly before it expires. It is zero for a token without expiry.
+	refreshAt time.Time
+	// pending is the token fetch in progress, nil if there is none.
+	pending *tokenFetch
+}
+
+// tokenFetch is a token fetch shared by the callers waiting for it.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewTokenSource creates a CachingTokenSource fetching access tokens from the client with the given credentials.
+// The credentials are looked up on every fetch, so rotated credentials are used for the next token. Failed
+// fetches are retried with the token retry policy of the client.
+func NewTokenSource(client *Client, credentials Credentials) *CachingTokenSource {
+	return &CachingTokenSource{
+		credentials: credentials,
+		refreshSkew: defaultTokenRefreshSkew,
+		now:         time.Now,
+		fetch:       client.fetchAccessTokenWithRetry,
+	}
+}
+
+// Token returns the cached access token, fetching a new one if there is none or it is about to expire.
+// A token without expiry is kept until it is invalidated.
+//
+// The fetch, with its retries, runs without holding the lock and is shared by all callers needing a token. A
+// caller stops waiting for it when its context is done, the fetch goes on for the others.
+func (s *CachingTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.token != "" && (s.refreshAt.IsZero() || s.now().Before(s.refreshAt)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	fetch := s.pending
+	if fetch == nil {
+		fetch = &tokenFetch{done: make(chan struct{})}
+		s.pending = fetch
+		// The fetch outlives a caller giving up, so it must not be canceled with the caller's context.
+		go s.runFetch(context.WithoutCancel(ctx), fetch)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// runFetch fetches a token, caches it and wakes the callers waiting for fetch.
+func (s *CachingTokenSource) runFetch(ctx context.Context, fetch *tokenFetch) {
+	var tokenResponse *oAuthTokenResponse
+	clientID, clientSecret, err := s.credentials.Credentials()
+	if err == nil {
+		tokenResponse, err = s.fetch(ctx, clientID, clientSecret)
+	}
+
+	s.mu.Lock()
+	s.pending = nil
+	if err == nil {
+		s.token = tokenResponse.AccessToken
+		s.refreshAt = time.Time{}
+		if tokenResponse.ExpiresIn > 0 {
+			// A token living no longer than the skew would be stale right away and fetched for every request.
+			ttl := time.Duration(tokenResponse.ExpiresIn) * time.Second
+			s.refreshAt = s.now().Add(ttl - min(s.refreshSkew, ttl/2))
+		}
+		fetch.token = s.token
+	}
+	fetch.err = err
+	s.mu.Unlock()
+
+	close(fetch.done)
+}
+
+// Invalidate drops the cached token if it is still the given one, so the next call to Token fetches a new one.
+// Passing the rejected token avoids discarding a token another caller has just refreshed.
+func (s *CachingTokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+		s.refreshAt = time.Time{}
+	}
+}
@@ -0,0 +1,281 @@
+package cipherowl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+	"github.com/piplabs/story-guardian/internal/pkg/retrypolicy"
+)
+
+// newTestTokenSource returns a CachingTokenSource issuing "token-1", "token-2", ... valid for expiresIn seconds.
+func newTestTokenSource(expiresIn int, now *time.Time) (*CachingTokenSource, *atomic.Int32) {
+	var fetches atomic.Int32
+	source := NewTokenSource(NewClient(), StaticCredentials{ClientID: "test_client_id", ClientSecret: "test_client_secret"})
+	source.now = func() time.Time { return *now }
+	source.fetch = func(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+		n := fetches.Add(1)
+		return &oAuthTokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: expiresIn}, nil
+	}
+
+	return source, &fetches
+}
+
+func TestCachingTokenSource_Token(t *testing.T) {
+	now := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		expiresIn   int
+		advance     time.Duration
+		invalidate  string
+		want        string
+		wantFetches int32
+	}{
+		{
+			name:        "cached token is reused",
+			expiresIn:   3600,
+			advance:     30 * time.Minute,
+			want:        "token-1",
+			wantFetches: 1,
+		},
+		{
+			name:        "token is refreshed shortly before expiry",
+			expiresIn:   3600,
+			advance:     time.Hour - defaultTokenRefreshSkew/2,
+			want:        "token-2",
+			wantFetches: 2,
+		},
+		{
+			name:        "short-lived token is reused within half its lifetime",
+			expiresIn:   30,
+			advance:     10 * time.Second,
+			want:        "token-1",
+			wantFetches: 1,
+		},
+		{
+			name:        "short-lived token is refreshed after half its lifetime",
+			expiresIn:   30,
+			advance:     20 * time.Second,
+			want:        "token-2",
+			wantFetches: 2,
+		},
+		{
+			name:        "token without expiry is kept",
+			expiresIn:   0,
+			advance:     24 * time.Hour,
+			want:        "token-1",
+			wantFetches: 1,
+		},
+		{
+			name:        "invalidated token is replaced",
+			expiresIn:   3600,
+			invalidate:  "token-1",
+			want:        "token-2",
+			wantFetches: 2,
+		},
+		{
+			name:        "invalidating a stale token keeps the current one",
+			expiresIn:   3600,
+			invalidate:  "token-0",
+			want:        "token-1",
+			wantFetches: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := now
+			source, fetches := newTestTokenSource(tt.expiresIn, &current)
+
+			if _, err := source.Token(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			current = current.Add(tt.advance)
+			if tt.invalidate != "" {
+				source.Invalidate(tt.invalidate)
+			}
+
+			got, err := source.Token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Token() got = %v, want %v", got, tt.want)
+			}
+			if fetches.Load() != tt.wantFetches {
+				t.Errorf("Token() fetched %d tokens, want %d", fetches.Load(), tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestCachingTokenSource_Concurrent(t *testing.T) {
+	now := time.Now()
+	source, fetches := newTestTokenSource(3600, &now)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := source.Token(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches.Load() != 1 {
+		t.Errorf("concurrent Token() calls fetched %d tokens, want 1", fetches.Load())
+	}
+}
+
+func TestCachingTokenSource_WaitCanceled(t *testing.T) {
+	source := NewTokenSource(NewClient(), StaticCredentials{ClientID: "test_client_id", ClientSecret: "test_client_secret"})
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	source.fetch = func(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+		fetches.Add(1)
+		<-release
+		return &oAuthTokenResponse{AccessToken: "test_access_token", ExpiresIn: 3600}, nil
+	}
+
+	// A caller giving up does not wait for the slow fetch, nor does it cancel it for the others.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := source.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Token() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	result := make(chan string)
+	go func() {
+		token, _ := source.Token(context.Background())
+		result <- token
+	}()
+	close(release)
+	if got := <-result; got != "test_access_token" {
+		t.Errorf("Token() = %q, want %q", got, "test_access_token")
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fetched %d tokens, want 1", fetches.Load())
+	}
+}
+
+func TestClient_doAuthorized_RefreshesOnUnauthorized(t *testing.T) {
+	now := time.Now()
+	source, fetches := newTestTokenSource(3600, &now)
+
+	// The first token is rejected as if it was revoked before its expiry.
+	var requests atomic.Int32
+	var rejectAll atomic.Bool
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if rejectAll.Load() || r.Header.Get(httpclient.AuthorizationHeader) != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": "invalid_token"}`)
+			return
+		}
+		io.WriteString(w, `{"presignedUrl": "test_presigned_url"}`)
+	}, WithTokenSource(source))
+
+	got, err := client.FetchBloomFilterURL(context.Background())
+	if err != nil {
+		t.Fatalf("FetchBloomFilterURL() error = %v", err)
+	}
+	if got != "test_presigned_url" {
+		t.Errorf("FetchBloomFilterURL() got = %v, want test_presigned_url", got)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("fetched %d tokens, want 2", fetches.Load())
+	}
+
+	// A token that keeps being rejected is retried only once.
+	rejectAll.Store(true)
+	requests.Store(0)
+	if _, err := client.FetchBloomFilterURL(context.Background()); err == nil {
+		t.Errorf("FetchBloomFilterURL() error = nil, want an error")
+	}
+	if count := requests.Load(); count != 2 {
+		t.Errorf("sent %d requests, want 2", count)
+	}
+}
+
+func TestCachingTokenSource_FetchError(t *testing.T) {
+	source := NewTokenSource(NewClient(), StaticCredentials{ClientID: "test_client_id", ClientSecret: "test_client_secret"})
+	source.fetch = func(ctx context.Context, clientID, clientSecret string) (*oAuthTokenResponse, error) {
+		return nil, errors.New("invalid_client")
+	}
+
+	if _, err := source.Token(context.Background()); err == nil {
+		t.Errorf("Token() error = nil, want an error")
+	}
+}
+
+func TestCachingTokenSource_RetriesFetch(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		failures    int32
+		wantErr     bool
+		wantFetches int32
+	}{
+		{
+			name:        "server fault retried",
+			status:      http.StatusServiceUnavailable,
+			body:        `{"error": "temporarily_unavailable"}`,
+			failures:    1,
+			wantErr:     false,
+			wantFetches: 2,
+		},
+		{
+			name:        "retries exhausted",
+			status:      http.StatusServiceUnavailable,
+			body:        `{"error": "temporarily_unavailable"}`,
+			failures:    3,
+			wantErr:     true,
+			wantFetches: 3,
+		},
+		{
+			name:        "bad credentials not retried",
+			status:      http.StatusUnauthorized,
+			body:        `{"error": "invalid_client"}`,
+			failures:    1,
+			wantErr:     true,
+			wantFetches: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if fetches.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					io.WriteString(w, tt.body)
+					return
+				}
+				io.WriteString(w, `{"access_token": "test_access_token", "expires_in": 3600}`)
+			}, WithTokenRetryPolicy(retrypolicy.Policy{Attempts: 3, InitialDelay: time.Millisecond}))
+			source := NewTokenSource(client, StaticCredentials{ClientID: "test_client_id", ClientSecret: "test_client_secret"})
+
+			_, err := source.Token(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Token() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// A failure the token policy gave up on is not retried again by the policy of the calling operation.
+			if err != nil && retrypolicy.IsTransient(err) {
+				t.Errorf("IsTransient(%v) = true, want false", err)
+			}
+			if got := fetches.Load(); got != tt.wantFetches {
+				t.Errorf("fetched %d times, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+}
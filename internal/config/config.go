@@ -2,32 +2,484 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+	"github.com/piplabs/story-guardian/internal/pkg/retrypolicy"
+	"github.com/piplabs/story-guardian/internal/report"
+)
+
+// Default CipherOwl API endpoints.
+const (
+	DefaultAPIBaseURL    = "https://svc.cipherowl.ai/"
+	DefaultAPIAudience   = "svc.cipherowl.ai"
+	DefaultAPITokenPath  = "oauth/token"
+	DefaultAPIFilterPath = "api/bloom-filter/file/" + FilterIDPlaceholder
+	DefaultAPIUploadPath = "api/upload/report/v1"
+
+	// FilterIDPlaceholder is replaced by the filter ID in the filter path.
+	FilterIDPlaceholder = "{filter_id}"
+	// DefaultFilterID is the bloom filter downloaded unless a network profile or the configuration selects another.
+	DefaultFilterID = "1"
+)
+
+const (
+	defaultReportFileName = "filtered_report.log"
+	defaultScheduleTime   = "00:00"
+
+	defaultArchiveDirName = "archive"
+	defaultArchiveMaxAge  = 90 * 24 * time.Hour
+	defaultArchiveMaxSize = 512 << 20 // 512 MiB
+
+	defaultTailOffsetFileName = "filtered_report.offset"
+	defaultTailBatchSize      = 256 << 10 // 256 KiB
+	defaultTailFlushInterval  = 30 * time.Second
+
+	defaultRetryMaxServerDelay = 10 * time.Minute
+
+	defaultHTTPMinTLSVersion = "1.2"
+)
+
+// Default retry policies. Downloads and uploads run once a day and may wait for an outage to pass, the token
+// fetch blocks the request it authorizes and gives up sooner.
+var (
+	defaultDownloadRetry = RetryPolicyConfig{Attempts: 6, InitialDelay: 3 * time.Second, MaxDelay: time.Minute, MaxElapsed: 15 * time.Minute}
+	defaultUploadRetry   = RetryPolicyConfig{Attempts: 6, InitialDelay: 3 * time.Second, MaxDelay: time.Minute, MaxElapsed: 15 * time.Minute}
+	defaultTokenRetry    = RetryPolicyConfig{Attempts: 3, InitialDelay: time.Second, MaxDelay: 10 * time.Second, MaxElapsed: time.Minute}
 )
 
 // AppConfig represents the application's configuration.
 type AppConfig struct {
 	ClientID     string `mapstructure:"client_id"`
 	ClientSecret string `mapstructure:"client_secret"`
+	// ClientIDFile and ClientSecretFile hold the credentials instead of ClientID and ClientSecret, they are
+	// re-read when they change.
+	ClientIDFile     string `mapstructure:"client_id_file"`
+	ClientSecretFile string `mapstructure:"client_secret_file"`
+	// Network is the Story network whose profile replaced the defaults, empty if none was selected.
+	Network string `mapstructure:"network"`
+	// OutputDirs are the directories the bloom filter file is installed into, such as those of several geth
+	// instances on one host. The filter is downloaded once for all of them.
+	OutputDirs []string `mapstructure:"output_dir"`
+	// ReportFile is the report of the transactions filtered by geth.
+	ReportFile     string               `mapstructure:"report_file"`
+	Schedule       ScheduleConfig       `mapstructure:"schedule"`
+	API            APIConfig            `mapstructure:"api"`
+	Archive        ArchiveConfig        `mapstructure:"archive"`
+	Redaction      RedactionConfig      `mapstructure:"redaction"`
+	Tail           TailConfig           `mapstructure:"tail"`
+	Retry          RetryConfig          `mapstructure:"retry"`
+	HTTP           HTTPConfig           `mapstructure:"http"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Metrics        MetricsConfig        `mapstructure:"metrics"`
+	Reload         ReloadConfig         `mapstructure:"reload"`
+}
+
+// ValidateCredentials checks that client credentials are configured. The daemon needs them to talk to CipherOwl,
+// the commands working on local files only, such as report, do not.
+func (c *AppConfig) ValidateCredentials() error {
+	if (c.ClientID == "" && c.ClientIDFile == "") || (c.ClientSecret == "" && c.ClientSecretFile == "") {
+		return fmt.Errorf("both client_id (or client_id_file) and client_secret (or client_secret_file) are required, " +
+			"set them in the configuration file or the CIPHEROWL_CLIENT_ID and CIPHEROWL_CLIENT_SECRET environment variables")
+	}
+
+	return nil
+}
+
+// ScheduleConfig controls when the bloom filter is downloaded.
+type ScheduleConfig struct {
+	// Time is the local time of day, HH:MM, of the daily download.
+	Time string `mapstructure:"time"`
 }
 
-// NewAppConfig initializes a new AppConfig instance.
-func NewAppConfig() (*AppConfig, error) {
-	// Set environment variable prefix for configuration
-	viper.SetEnvPrefix("cipherowl")
-	viper.AutomaticEnv()
+// Validate checks that the time of day is valid.
+func (c ScheduleConfig) Validate() error {
+	if _, err := time.Parse(scheduleTimeLayout, c.Time); err != nil {
+		return fmt.Errorf("schedule time %q must be a time of day as HH:MM", c.Time)
+	}
 
-	clientID := viper.GetString("client_id")
-	clientSecret := viper.GetString("client_secret")
+	return nil
+}
 
-	// Validate configuration inputs
-	if clientID == "" || clientSecret == "" {
-		return nil, fmt.Errorf("both CLIENT_ID and CLIENT_SECRET environment variables are required")
+// Next returns the first scheduled time after now, in the location of now. An invalid schedule runs at midnight.
+func (c ScheduleConfig) Next(now time.Time) time.Time {
+	at, _ := time.Parse(scheduleTimeLayout, c.Time)
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
 	}
 
-	return &AppConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
+	return next
+}
+
+// APIConfig locates the CipherOwl API.
+type APIConfig struct {
+	// BaseURL is the root URL the filter and upload paths are resolved against.
+	BaseURL string `mapstructure:"base_url"`
+	// TokenURL is the OAuth token endpoint, defaults to the token path below the base URL.
+	TokenURL string `mapstructure:"token_url"`
+	// Audience is the OAuth audience access tokens are requested for.
+	Audience string `mapstructure:"audience"`
+	// FilterPath is the path of the bloom filter presigned URL endpoint, FilterIDPlaceholder is replaced by FilterID.
+	FilterPath string `mapstructure:"filter_path"`
+	// FilterID selects the bloom filter of the network.
+	FilterID string `mapstructure:"filter_id"`
+	// UploadPath is the path of the report upload endpoint.
+	UploadPath string `mapstructure:"upload_path"`
+}
+
+// DefaultAPIConfig returns the configuration of the production CipherOwl API.
+func DefaultAPIConfig() APIConfig {
+	return APIConfig{
+		BaseURL:    DefaultAPIBaseURL,
+		Audience:   DefaultAPIAudience,
+		FilterPath: DefaultAPIFilterPath,
+		FilterID:   DefaultFilterID,
+		UploadPath: DefaultAPIUploadPath,
+	}
+}
+
+// Validate checks that every endpoint resolves to an absolute HTTP(S) URL.
+func (c APIConfig) Validate() error {
+	if err := validateURL("base URL", c.BaseURL); err != nil {
+		return err
+	}
+	if c.TokenURL != "" {
+		if err := validateURL("token URL", c.TokenURL); err != nil {
+			return err
+		}
+	}
+	if c.Audience == "" {
+		return fmt.Errorf("API audience must not be empty")
+	}
+	for name, path := range map[string]string{"filter path": c.FilterPath, "upload path": c.UploadPath} {
+		if path == "" {
+			return fmt.Errorf("API %s must not be empty", name)
+		}
+		if u, err := url.Parse(path); err != nil || u.IsAbs() || u.Host != "" {
+			return fmt.Errorf("API %s %q must be a path relative to the base URL", name, path)
+		}
+	}
+	if strings.Contains(c.FilterPath, FilterIDPlaceholder) && c.FilterID == "" {
+		return fmt.Errorf("API filter ID must not be empty, the filter path %q refers to it", c.FilterPath)
+	}
+
+	return nil
+}
+
+// TokenEndpoint returns the URL of the OAuth token endpoint.
+func (c APIConfig) TokenEndpoint() string {
+	if c.TokenURL != "" {
+		return c.TokenURL
+	}
+
+	return joinURL(c.BaseURL, DefaultAPITokenPath)
+}
+
+// FilterEndpoint returns the URL of the bloom filter presigned URL endpoint.
+func (c APIConfig) FilterEndpoint() string {
+	return joinURL(c.BaseURL, strings.ReplaceAll(c.FilterPath, FilterIDPlaceholder, url.PathEscape(c.FilterID)))
+}
+
+// UploadEndpoint returns the URL of the report upload endpoint.
+func (c APIConfig) UploadEndpoint() string {
+	return joinURL(c.BaseURL, c.UploadPath)
+}
+
+// ArchiveConfig controls the local archive of uploaded report files.
+type ArchiveConfig struct {
+	// Enabled keeps a compressed copy of every uploaded report instead of deleting it.
+	Enabled bool `mapstructure:"enabled"`
+	// Dir is the directory holding the dated archive folders and the upload index.
+	Dir string `mapstructure:"dir"`
+	// MaxAge is the retention period of archived reports, zero disables age-based pruning.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// MaxSize is the total size in bytes the archive may occupy, zero disables size-based pruning.
+	MaxSize int64 `mapstructure:"max_size"`
+}
+
+// RedactionConfig controls which report fields are redacted before upload.
+type RedactionConfig struct {
+	// Fields maps a report field name to one of the actions keep, drop, hash or truncate.
+	Fields map[string]string `mapstructure:"fields"`
+	// Salt is prepended to a field value before it is hashed.
+	Salt string `mapstructure:"salt"`
+	// TruncateLength is the number of characters kept by the truncate action.
+	TruncateLength int `mapstructure:"truncate_length"`
+}
+
+// Policy builds the redaction policy described by the configuration.
+func (c RedactionConfig) Policy() (report.Policy, error) {
+	return report.NewPolicy(c.Fields, c.Salt, c.TruncateLength)
+}
+
+// TailConfig controls the near-real-time upload of the report file.
+type TailConfig struct {
+	// Enabled follows the report file and uploads new lines continuously.
+	Enabled bool `mapstructure:"enabled"`
+	// OffsetFile persists the read position in the report file across restarts.
+	OffsetFile string `mapstructure:"offset_file"`
+	// BatchSize is the size in bytes at which a batch is uploaded without waiting for the interval.
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval is the maximum time new lines wait before they are uploaded.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// RetryConfig controls how failed downloads, uploads and access token fetches are retried.
+type RetryConfig struct {
+	// MaxServerDelay caps the delay a rate limited or unavailable server may ask for before the next attempt.
+	MaxServerDelay time.Duration     `mapstructure:"max_server_delay"`
+	Download       RetryPolicyConfig `mapstructure:"download"`
+	Upload         RetryPolicyConfig `mapstructure:"upload"`
+	Token          RetryPolicyConfig `mapstructure:"token"`
+}
+
+// RetryPolicyConfig configures the exponential backoff of one operation.
+type RetryPolicyConfig struct {
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts uint `mapstructure:"attempts"`
+	// InitialDelay bounds the first backoff, the bound doubles with every attempt up to MaxDelay.
+	InitialDelay time.Duration `mapstructure:"initial_delay"`
+	MaxDelay     time.Duration `mapstructure:"max_delay"`
+	// MaxElapsed stops retrying once this much time passed since the first attempt, zero disables the limit.
+	MaxElapsed time.Duration `mapstructure:"max_elapsed"`
+}
+
+// DefaultRetryConfig returns the retry configuration used when none is set.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxServerDelay: defaultRetryMaxServerDelay,
+		Download:       defaultDownloadRetry,
+		Upload:         defaultUploadRetry,
+		Token:          defaultTokenRetry,
+	}
+}
+
+// DownloadPolicy returns the retry policy of bloom filter downloads.
+func (c RetryConfig) DownloadPolicy() retrypolicy.Policy {
+	return c.Download.policy("download bloom filter", c.MaxServerDelay)
+}
+
+// UploadPolicy returns the retry policy of report uploads.
+func (c RetryConfig) UploadPolicy() retrypolicy.Policy {
+	return c.Upload.policy("upload report", c.MaxServerDelay)
+}
+
+// TokenPolicy returns the retry policy of access token fetches.
+func (c RetryConfig) TokenPolicy() retrypolicy.Policy {
+	return c.Token.policy("fetch access token", c.MaxServerDelay)
+}
+
+// policy returns the retry policy of the named operation.
+func (c RetryPolicyConfig) policy(name string, maxServerDelay time.Duration) retrypolicy.Policy {
+	return retrypolicy.Policy{
+		Name:           name,
+		Attempts:       c.Attempts,
+		InitialDelay:   c.InitialDelay,
+		MaxDelay:       c.MaxDelay,
+		MaxElapsed:     c.MaxElapsed,
+		MaxServerDelay: maxServerDelay,
+	}
+}
+
+// Validate checks that the policy makes at least one attempt and has no negative durations.
+func (c RetryPolicyConfig) Validate() error {
+	if c.Attempts == 0 {
+		return fmt.Errorf("attempts must be positive")
+	}
+	if c.InitialDelay < 0 || c.MaxDelay < 0 || c.MaxElapsed < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+	if c.MaxDelay > 0 && c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("maximum delay %s is shorter than the initial delay %s", c.MaxDelay, c.InitialDelay)
+	}
+
+	return nil
+}
+
+// CircuitBreakerConfig controls the circuit breakers failing requests to an endpoint fast while it is down.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures opening the breaker of an endpoint, zero disables
+	// the breakers.
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// Cooldown is how long an open breaker rejects requests before it lets trial requests through.
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// HalfOpenRequests is the number of trial requests that must succeed to close the breaker again.
+	HalfOpenRequests int `mapstructure:"half_open_requests"`
+}
+
+// BreakerConfig returns the circuitbreaker configuration.
+func (c CircuitBreakerConfig) BreakerConfig() circuitbreaker.Config {
+	return circuitbreaker.Config{
+		FailureThreshold: c.FailureThreshold,
+		Cooldown:         c.Cooldown,
+		HalfOpenRequests: c.HalfOpenRequests,
+	}
+}
+
+// MetricsConfig controls the metrics endpoint.
+type MetricsConfig struct {
+	// Listen is the address serving the metrics and the circuit breaker states at /debug/vars, empty disables it.
+	Listen string `mapstructure:"listen"`
+}
+
+// ReloadConfig controls when the daemon reloads its configuration, which it always does on SIGHUP.
+type ReloadConfig struct {
+	// Watch reloads the configuration when the configuration file changes.
+	Watch bool `mapstructure:"watch"`
+}
+
+// HTTPConfig controls how the guardian connects to CipherOwl and the presigned download host.
+type HTTPConfig struct {
+	// Proxy is the URL of the proxy requests are sent through, the HTTPS_PROXY and HTTP_PROXY environment
+	// variables are used if it is empty.
+	Proxy string `mapstructure:"proxy"`
+	// NoProxy lists the hosts, domains, IP addresses and CIDR ranges contacted without proxy.
+	NoProxy []string `mapstructure:"no_proxy"`
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system ones.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key for gateways requiring mutual TLS.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// MinTLSVersion is the minimum TLS version of outbound connections, such as "1.2" or "1.3".
+	MinTLSVersion string `mapstructure:"min_tls_version"`
+
+	// Timeout limits a whole request including its body, zero disables the limit.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout limit the respective phase of a request.
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// BodyIdleTimeout aborts a download that delivers no data for this long.
+	BodyIdleTimeout time.Duration `mapstructure:"body_idle_timeout"`
+	// MaxIdleConns and MaxIdleConnsPerHost limit the pooled keep-alive connections.
+	MaxIdleConns        int `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// IdleConnTimeout is how long an idle keep-alive connection is kept.
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// Debug logs the timing breakdown of every request.
+	Debug bool `mapstructure:"debug"`
+}
+
+// ClientConfig returns the httpclient configuration, given the parsed minimum TLS version.
+func (c HTTPConfig) ClientConfig() (httpclient.Config, error) {
+	minTLSVersion, err := httpclient.ParseTLSVersion(c.MinTLSVersion)
+	if err != nil {
+		return httpclient.Config{}, err
+	}
+
+	return httpclient.Config{
+		Timeout:               c.Timeout,
+		DialTimeout:           c.DialTimeout,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		BodyIdleTimeout:       c.BodyIdleTimeout,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		ProxyURL:              c.Proxy,
+		NoProxy:               c.NoProxy,
+		CAFile:                c.CAFile,
+		CertFile:              c.CertFile,
+		KeyFile:               c.KeyFile,
+		MinTLSVersion:         minTLSVersion,
+		Debug:                 c.Debug,
 	}, nil
 }
+
+// DefaultConfigName is the name of the configuration file looked up in the guardian directory, with a .yaml,
+// .yml or .toml extension.
+const DefaultConfigName = "config"
+
+// scheduleTimeLayout is the layout of the schedule time of day.
+const scheduleTimeLayout = "15:04"
+
+// flagKeys maps the configuration keys set by command line flags to the flag names.
+var flagKeys = map[string]string{
+	"network":    "network",
+	"output_dir": "output-dir",
+}
+
+// NewAppConfig initializes a new AppConfig instance. Settings are read from the configuration file, which is
+// configFile or else the config file in the guardian directory if there is one, from the environment, which
+// overrides the file, and from the flags, which override both.
+func NewAppConfig(configFile string, flags *pflag.FlagSet) (*AppConfig, error) {
+	sources, err := ReadSources(configFile, flags)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range sources.Warnings() {
+		log.Printf("warning: %s", warning)
+	}
+
+	return sources.AppConfig()
+}
+
+// retryPolicyConfig reads the retry policy under key.
+func retryPolicyConfig(v *viper.Viper, key string) RetryPolicyConfig {
+	return RetryPolicyConfig{
+		Attempts:     v.GetUint(key + ".attempts"),
+		InitialDelay: v.GetDuration(key + ".initial_delay"),
+		MaxDelay:     v.GetDuration(key + ".max_delay"),
+		MaxElapsed:   v.GetDuration(key + ".max_elapsed"),
+	}
+}
+
+// expandHome replaces a leading "~/" of a path with the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+// validateURL checks that value is an absolute HTTP(S) URL.
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid API %s %q: %w", name, value, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("API %s %q must be an absolute http or https URL", name, value)
+	}
+
+	return nil
+}
+
+// splitList splits comma-separated entries, as a list read from an environment variable is only split at spaces.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+	}
+
+	return list
+}
+
+// joinURL appends a relative path to a validated base URL, keeping the path of the base URL.
+func joinURL(base, path string) string {
+	joined, err := url.JoinPath(base, path)
+	if err != nil {
+		return base + path
+	}
+
+	return joined
+}
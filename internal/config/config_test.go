@@ -0,0 +1,337 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestAPIConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(c *APIConfig)
+		wantErr    bool
+		wantToken  string
+		wantFilter string
+		wantUpload string
+	}{
+		{
+			name:       "defaults",
+			modify:     func(c *APIConfig) {},
+			wantToken:  "https://svc.cipherowl.ai/oauth/token",
+			wantFilter: "https://svc.cipherowl.ai/api/bloom-filter/file/1",
+			wantUpload: "https://svc.cipherowl.ai/api/upload/report/v1",
+		},
+		{
+			name: "staging base URL with path and separate token URL",
+			modify: func(c *APIConfig) {
+				c.BaseURL = "https://staging.example.com/cipherowl"
+				c.TokenURL = "https://auth.example.com/oauth/token"
+			},
+			wantToken:  "https://auth.example.com/oauth/token",
+			wantFilter: "https://staging.example.com/cipherowl/api/bloom-filter/file/1",
+			wantUpload: "https://staging.example.com/cipherowl/api/upload/report/v1",
+		},
+		{
+			name: "local stand-in",
+			modify: func(c *APIConfig) {
+				c.BaseURL = "http://127.0.0.1:8080/"
+				c.FilterPath = "filters/2"
+			},
+			wantToken:  "http://127.0.0.1:8080/oauth/token",
+			wantFilter: "http://127.0.0.1:8080/filters/2",
+			wantUpload: "http://127.0.0.1:8080/api/upload/report/v1",
+		},
+		{
+			name:       "filter ID",
+			modify:     func(c *APIConfig) { c.FilterID = "aeneid 2" },
+			wantToken:  "https://svc.cipherowl.ai/oauth/token",
+			wantFilter: "https://svc.cipherowl.ai/api/bloom-filter/file/aeneid%202",
+			wantUpload: "https://svc.cipherowl.ai/api/upload/report/v1",
+		},
+		{
+			name:    "empty filter ID",
+			modify:  func(c *APIConfig) { c.FilterID = "" },
+			wantErr: true,
+		},
+		{
+			name:    "base URL without scheme",
+			modify:  func(c *APIConfig) { c.BaseURL = "svc.cipherowl.ai" },
+			wantErr: true,
+		},
+		{
+			name:    "unsupported token URL scheme",
+			modify:  func(c *APIConfig) { c.TokenURL = "ftp://auth.example.com/token" },
+			wantErr: true,
+		},
+		{
+			name:    "absolute upload path",
+			modify:  func(c *APIConfig) { c.UploadPath = "https://other.example.com/upload" },
+			wantErr: true,
+		},
+		{
+			name:    "empty audience",
+			modify:  func(c *APIConfig) { c.Audience = "" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultAPIConfig()
+			tt.modify(&c)
+
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := c.TokenEndpoint(); got != tt.wantToken {
+				t.Errorf("TokenEndpoint() = %v, want %v", got, tt.wantToken)
+			}
+			if got := c.FilterEndpoint(); got != tt.wantFilter {
+				t.Errorf("FilterEndpoint() = %v, want %v", got, tt.wantFilter)
+			}
+			if got := c.UploadEndpoint(); got != tt.wantUpload {
+				t.Errorf("UploadEndpoint() = %v, want %v", got, tt.wantUpload)
+			}
+		})
+	}
+}
+
+func Test_splitList(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "empty", values: nil, want: nil},
+		{name: "comma-separated environment variable", values: []string{"localhost,.internal, 10.0.0.0/8"}, want: []string{"localhost", ".internal", "10.0.0.0/8"}},
+		{name: "list from configuration", values: []string{"localhost", "", "10.0.0.0/8"}, want: []string{"localhost", "10.0.0.0/8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitList(tt.values); !slices.Equal(got, tt.want) {
+				t.Errorf("splitList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RetryPolicyConfig
+		wantErr bool
+	}{
+		{name: "default download policy", config: DefaultRetryConfig().Download},
+		{name: "single attempt without delays", config: RetryPolicyConfig{Attempts: 1}},
+		{name: "no attempts", config: RetryPolicyConfig{InitialDelay: time.Second}, wantErr: true},
+		{name: "negative elapsed time", config: RetryPolicyConfig{Attempts: 3, MaxElapsed: -time.Second}, wantErr: true},
+		{name: "maximum below initial delay", config: RetryPolicyConfig{Attempts: 3, InitialDelay: time.Minute, MaxDelay: time.Second}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAppConfig_Sources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+client_id: file_client_id
+client_secret: file_client_secret
+output_dir: /var/lib/guardian/file
+schedule:
+  time: "03:30"
+retry:
+  download:
+    attempts: 2
+    max_elapsed: 5m
+http:
+  no_proxy: [localhost, .internal]
+redaction:
+  salt: file_salt
+  fields:
+    from: hash
+`,
+		"config.toml": `
+client_id = "file_client_id"
+client_secret = "file_client_secret"
+output_dir = "/var/lib/guardian/file"
+
+[schedule]
+time = "03:30"
+
+[retry.download]
+attempts = 2
+max_elapsed = "5m"
+
+[http]
+no_proxy = ["localhost", ".internal"]
+
+[redaction]
+salt = "file_salt"
+
+[redaction.fields]
+from = "hash"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			conf, err := NewAppConfig(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conf.ClientID != "file_client_id" || !slices.Equal(conf.OutputDirs, []string{"/var/lib/guardian/file"}) || conf.Schedule.Time != "03:30" {
+				t.Errorf("NewAppConfig() = %+v, want the values of the file", conf)
+			}
+			if conf.Retry.Download.Attempts != 2 || conf.Retry.Download.MaxElapsed != 5*time.Minute ||
+				conf.Retry.Download.InitialDelay != defaultDownloadRetry.InitialDelay {
+				t.Errorf("download retry = %+v, want the file values and the default initial delay", conf.Retry.Download)
+			}
+			if !slices.Equal(conf.HTTP.NoProxy, []string{"localhost", ".internal"}) || conf.Redaction.Fields["from"] != "hash" {
+				t.Errorf("no proxy = %q, redaction = %v, want the lists and maps of the file", conf.HTTP.NoProxy, conf.Redaction.Fields)
+			}
+
+			// The environment overrides the file, and flags override both.
+			t.Setenv("CIPHEROWL_RETRY_DOWNLOAD_ATTEMPTS", "4")
+			t.Setenv("CIPHEROWL_OUTPUT_DIR", "/var/lib/guardian/env")
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.StringSliceP("output-dir", "o", nil, "")
+			if err := flags.Parse([]string{"-o", "/var/lib/guardian/archive", "-o", "/var/lib/guardian/rpc"}); err != nil {
+				t.Fatal(err)
+			}
+
+			conf, err = NewAppConfig(path, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conf.Retry.Download.Attempts != 4 {
+				t.Errorf("download attempts = %d, want the environment value 4", conf.Retry.Download.Attempts)
+			}
+			if want := []string{"/var/lib/guardian/archive", "/var/lib/guardian/rpc"}; !slices.Equal(conf.OutputDirs, want) {
+				t.Errorf("output directories = %q, want the flag values %q", conf.OutputDirs, want)
+			}
+		})
+	}
+}
+
+func TestNewAppConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "missing file", path: filepath.Join(dir, "missing.yaml")},
+		{name: "malformed file", path: write("malformed.yaml", "client_id: [unterminated\n")},
+		{name: "invalid schedule", path: write("schedule.yaml", "client_id: a\nclient_secret: b\nschedule:\n  time: \"25:00\"\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAppConfig(tt.path, nil); err == nil {
+				t.Errorf("NewAppConfig() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestScheduleConfig_Next(t *testing.T) {
+	now := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		time string
+		want time.Time
+	}{
+		{time: "00:00", want: time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC)},
+		{time: "13:15", want: time.Date(2024, 11, 14, 13, 15, 0, 0, time.UTC)},
+		{time: "12:00", want: time.Date(2024, 11, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.time, func(t *testing.T) {
+			if got := (ScheduleConfig{Time: tt.time}).Next(now); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAppConfig_OutputDirs(t *testing.T) {
+	t.Setenv("CIPHEROWL_CLIENT_ID", "test_client_id")
+	t.Setenv("CIPHEROWL_CLIENT_SECRET", "test_client_secret")
+
+	tests := []struct {
+		name    string
+		content string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "list in the file",
+			content: "output_dir: [/srv/archive/guardian, /srv/rpc/guardian/]\n",
+			want:    []string{"/srv/archive/guardian", "/srv/rpc/guardian"},
+		}, {
+			name: "comma-separated environment variable",
+			env:  "/srv/archive/guardian, /srv/rpc/guardian",
+			want: []string{"/srv/archive/guardian", "/srv/rpc/guardian"},
+		}, {
+			name: "environment variable with a space in the path",
+			env:  "/srv/geth node/guardian",
+			want: []string{"/srv/geth node/guardian"},
+		}, {
+			name:    "scalar in the file with a space in the path",
+			content: "output_dir: /srv/geth node/guardian\n",
+			want:    []string{"/srv/geth node/guardian"},
+		}, {
+			name:    "directory listed twice",
+			content: "output_dir: [/srv/archive/guardian, /srv/archive/guardian/]\n",
+			wantErr: true,
+		}, {
+			name:    "empty list",
+			content: "output_dir: []\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("CIPHEROWL_OUTPUT_DIR", tt.env)
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			conf, err := NewAppConfig(path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAppConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(conf.OutputDirs, tt.want) {
+				t.Errorf("output directories = %q, want %q", conf.OutputDirs, tt.want)
+			}
+		})
+	}
+}
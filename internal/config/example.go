@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exampleHeader introduces the example configuration file.
+const exampleHeader = `# Story Guardian configuration file.
+#
+# Every setting is listed commented out with its default value. Settings can also be set by environment variables,
+# such as CIPHEROWL_RETRY_DOWNLOAD_ATTEMPTS for retry.download.attempts, which override this file. Command line
+# flags override both. A leading ~/ in a path refers to the home directory.
+`
+
+// exampleNetworks documents the user-defined network profiles, which are no setting of their own.
+const exampleNetworks = `
+# User-defined network profiles, selected by the network setting like the built-in ones. A profile named after a
+# built-in network overrides its fields. The guardian directory defaults to ~/.story/geth/<network>/guardian and
+# holds the bloom filter, the report file, the archive and the tail offset.
+# networks:
+#   my-devnet:
+#     guardian_dir: ~/devnet/guardian
+#     filter_id: "7"
+#     base_url: "http://127.0.0.1:8090/"
+#     token_url: ""
+#     audience: "svc.cipherowl.ai"
+`
+
+// WriteExample writes a YAML configuration file documenting every setting with its default.
+func WriteExample(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(exampleHeader)
+
+	var sections []string
+	for _, setting := range Settings() {
+		path := strings.Split(setting.Key, ".")
+		keySections, name := path[:len(path)-1], path[len(path)-1]
+
+		// Open the sections of the key that are not open yet.
+		common := 0
+		for common < len(sections) && common < len(keySections) && sections[common] == keySections[common] {
+			common++
+		}
+		sections = keySections
+		for depth := common; depth < len(keySections); depth++ {
+			fmt.Fprintf(bw, "\n%s%s:", indent(depth), keySections[depth])
+		}
+
+		// Settings are separated by a blank line, a setting opening a section directly follows its header.
+		prefix := indent(len(keySections))
+		fmt.Fprintf(bw, "\n%s# %s\n", prefix, setting.Description)
+		fmt.Fprintf(bw, "%s# %s: %s\n", prefix, name, exampleValue(setting.Default))
+	}
+	bw.WriteString(exampleNetworks)
+
+	return bw.Flush()
+}
+
+// indent returns the indentation of a key nested depth sections deep.
+func indent(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+// exampleValue formats a default value as YAML, paths below the home directory start with ~/.
+func exampleValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		if home, err := os.UserHomeDir(); err == nil && home != "" && strings.HasPrefix(v, home+string(os.PathSeparator)) {
+			v = "~/" + strings.TrimPrefix(v, home+string(os.PathSeparator))
+		}
+		return strconv.Quote(v)
+	case time.Duration:
+		return durationValue(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = exampleValue(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case map[string]string:
+		if len(v) == 0 {
+			return "{}"
+		}
+		entries := make([]string, 0, len(v))
+		for key, s := range v {
+			entries = append(entries, key+": "+exampleValue(s))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// durationValue formats a duration without zero units, such as "10m" instead of "10m0s".
+func durationValue(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
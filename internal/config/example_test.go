@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteExample_LoadsDefaults(t *testing.T) {
+	var example bytes.Buffer
+	if err := WriteExample(&example); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, example.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every setting of the example is commented out, loading it yields the defaults.
+	t.Setenv("CIPHEROWL_CLIENT_ID", "test_client_id")
+	t.Setenv("CIPHEROWL_CLIENT_SECRET", "test_client_secret")
+	fromExample, err := NewAppConfig(path, nil)
+	if err != nil {
+		t.Fatalf("NewAppConfig() with the example error = %v", err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defaults, err := NewAppConfig(empty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromExample, defaults) {
+		t.Errorf("configuration of the example = %+v, want the defaults %+v", fromExample, defaults)
+	}
+}
+
+func TestSettings_CoverAppConfig(t *testing.T) {
+	documented := make(map[string]bool)
+	for _, setting := range Settings() {
+		if documented[setting.Key] {
+			t.Errorf("setting %s is listed twice", setting.Key)
+		}
+		documented[setting.Key] = true
+	}
+
+	for _, key := range configKeys(reflect.TypeOf(AppConfig{}), "") {
+		if !documented[key] {
+			t.Errorf("configuration key %s has no setting", key)
+		}
+	}
+}
+
+// configKeys returns the dotted mapstructure keys of the fields of a configuration struct.
+func configKeys(typ reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == typ.PkgPath() {
+			keys = append(keys, configKeys(field.Type, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestExampleFile_UpToDate(t *testing.T) {
+	// The example file documents the Linux default paths.
+	if runtime.GOOS != "linux" {
+		t.Skip("the example file is generated on Linux")
+	}
+
+	want, err := os.ReadFile(filepath.Join("..", "..", "config.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := WriteExample(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("config.example.yaml is outdated, regenerate it with: go run . config example > config.example.yaml\n%s",
+			firstDifference(got.String(), string(want)))
+	}
+}
+
+// firstDifference returns the first line differing between got and want.
+func firstDifference(got, want string) string {
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := range min(len(gotLines), len(wantLines)) {
+		if gotLines[i] != wantLines[i] {
+			return "got:  " + gotLines[i] + "\nwant: " + wantLines[i]
+		}
+	}
+
+	return "the files differ in length"
+}
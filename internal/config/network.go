@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/piplabs/story-guardian/utils"
+)
+
+// Built-in Story networks.
+const (
+	NetworkMainnet = "mainnet"
+	NetworkAeneid  = "aeneid"
+	// NetworkLocal is a local devnet, talking to the fake CipherOwl server of the fake-server command.
+	NetworkLocal = "local"
+)
+
+// localAPIBaseURL is the default address of the fake CipherOwl server.
+const localAPIBaseURL = "http://127.0.0.1:8090/"
+
+// networksKey is the section of the configuration file holding the user-defined network profiles.
+const networksKey = "networks"
+
+// networkNamePattern restricts network names, which become a directory name.
+var networkNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// NetworkProfile holds the settings that differ between Story networks. They replace the defaults, so the
+// configuration file, the environment and the flags still override them. Empty fields keep the defaults.
+type NetworkProfile struct {
+	// GuardianDir is the directory of the bloom filter, the report file, the archive and the tail offset,
+	// ~/.story/geth/<network>/guardian by default.
+	GuardianDir string `mapstructure:"guardian_dir"`
+	// FilterID selects the bloom filter of the network.
+	FilterID string `mapstructure:"filter_id"`
+	// BaseURL, TokenURL and Audience locate the CipherOwl API serving the network.
+	BaseURL  string `mapstructure:"base_url"`
+	TokenURL string `mapstructure:"token_url"`
+	Audience string `mapstructure:"audience"`
+
+	// requireFilterID marks a network whose bloom filter differs from the default one of mainnet, but whose
+	// filter ID is not built in. It must be configured, or the node would silently use the mainnet filter.
+	requireFilterID bool
+}
+
+// builtinNetworks returns the profiles of the built-in networks, which use the production CipherOwl API unless
+// noted otherwise.
+func builtinNetworks() map[string]NetworkProfile {
+	return map[string]NetworkProfile{
+		NetworkMainnet: {},
+		NetworkAeneid:  {requireFilterID: true},
+		NetworkLocal:   {BaseURL: localAPIBaseURL},
+	}
+}
+
+// settings returns the configuration keys set by the profile of network.
+func (p NetworkProfile) settings(network string) map[string]any {
+	dir := expandHome(p.GuardianDir)
+	if dir == "" {
+		dir = utils.GetNetworkPath(network)
+	}
+
+	settings := make(map[string]any)
+	for key, value := range guardianFiles(dir) {
+		settings[key] = value
+	}
+	// The output directories are a list like their default, the guardian directory is a single entry of it.
+	settings["output_dir"] = []string{dir}
+	for key, value := range map[string]string{
+		"api.filter_id": p.FilterID,
+		"api.base_url":  p.BaseURL,
+		"api.token_url": p.TokenURL,
+		"api.audience":  p.Audience,
+	} {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+
+	return settings
+}
+
+// guardianFiles returns the settings of the files kept in a guardian directory.
+func guardianFiles(dir string) map[string]string {
+	return map[string]string{
+		"output_dir":       dir,
+		"report_file":      filepath.Join(dir, defaultReportFileName),
+		"archive.dir":      filepath.Join(dir, defaultArchiveDirName),
+		"tail.offset_file": filepath.Join(dir, defaultTailOffsetFileName),
+	}
+}
+
+// lookupNetwork returns the profile of network. A user-defined profile of the networks section overrides the
+// fields of the built-in profile of the same name.
+func lookupNetwork(v *viper.Viper, network string) (NetworkProfile, error) {
+	if !networkNamePattern.MatchString(network) {
+		return NetworkProfile{}, fmt.Errorf("network %q must consist of lower case letters, digits, '-' and '_'", network)
+	}
+
+	var userNetworks map[string]NetworkProfile
+	if err := v.UnmarshalKey(networksKey, &userNetworks); err != nil {
+		return NetworkProfile{}, fmt.Errorf("invalid network profiles: %w", err)
+	}
+	builtin, isBuiltin := builtinNetworks()[network]
+	user, isUser := userNetworks[network]
+	if !isBuiltin && !isUser {
+		names := slices.Collect(maps.Keys(builtinNetworks()))
+		for name := range userNetworks {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		return NetworkProfile{}, fmt.Errorf("unknown network %q, expected one of %s", network, strings.Join(names, ", "))
+	}
+
+	profile := builtin
+	for field, value := range map[*string]string{
+		&profile.GuardianDir: user.GuardianDir,
+		&profile.FilterID:    user.FilterID,
+		&profile.BaseURL:     user.BaseURL,
+		&profile.TokenURL:    user.TokenURL,
+		&profile.Audience:    user.Audience,
+	} {
+		if value != "" {
+			*field = value
+		}
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/piplabs/story-guardian/utils"
+)
+
+func TestReadSources_Network(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CIPHEROWL_CLIENT_ID", "test_client_id")
+	t.Setenv("CIPHEROWL_CLIENT_SECRET", "test_client_secret")
+
+	networks := `
+networks:
+  devnet:
+    guardian_dir: ~/devnet/guardian
+    filter_id: "7"
+    base_url: http://127.0.0.1:9000/
+  spaced:
+    guardian_dir: /srv/my node/guardian
+  aeneid:
+    filter_id: "2"
+`
+	tests := []struct {
+		name          string
+		content       string
+		flag          string
+		wantOutputDir string
+		// wantReportDir is the directory of the report file, wantOutputDir if empty.
+		wantReportDir string
+		wantFilter    string
+		wantSource    Source
+	}{
+		{
+			name:          "no network",
+			content:       networks,
+			wantOutputDir: utils.GetDefaultPath(),
+			wantFilter:    "https://svc.cipherowl.ai/api/bloom-filter/file/1",
+			wantSource:    SourceDefault,
+		}, {
+			name:          "built-in network",
+			content:       "network: mainnet\n",
+			wantOutputDir: utils.GetNetworkPath("mainnet"),
+			wantFilter:    "https://svc.cipherowl.ai/api/bloom-filter/file/1",
+			wantSource:    SourceNetwork,
+		}, {
+			name:          "built-in network overridden by a user profile",
+			content:       networks,
+			flag:          "aeneid",
+			wantOutputDir: utils.GetNetworkPath("aeneid"),
+			wantFilter:    "https://svc.cipherowl.ai/api/bloom-filter/file/2",
+			wantSource:    SourceNetwork,
+		}, {
+			name:          "user-defined network",
+			content:       networks,
+			flag:          "devnet",
+			wantOutputDir: filepath.Join(home, "devnet", "guardian"),
+			wantFilter:    "http://127.0.0.1:9000/api/bloom-filter/file/7",
+			wantSource:    SourceNetwork,
+		}, {
+			name:          "guardian directory with a space",
+			content:       networks,
+			flag:          "spaced",
+			wantOutputDir: "/srv/my node/guardian",
+			wantFilter:    "https://svc.cipherowl.ai/api/bloom-filter/file/1",
+			wantSource:    SourceNetwork,
+		}, {
+			name:          "file overrides the profile",
+			content:       networks + "output_dir: /var/lib/guardian\napi:\n  filter_id: \"9\"\n",
+			flag:          "devnet",
+			wantOutputDir: "/var/lib/guardian",
+			wantReportDir: filepath.Join(home, "devnet", "guardian"),
+			wantFilter:    "http://127.0.0.1:9000/api/bloom-filter/file/9",
+			wantSource:    SourceFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.String("network", "", "")
+			if tt.flag != "" {
+				if err := flags.Parse([]string{"--network", tt.flag}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sources, err := ReadSources(writeConfigFile(t, tt.content), flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if warnings := sources.Warnings(); len(warnings) > 0 {
+				t.Errorf("Warnings() = %q, want the network profiles to be known keys", warnings)
+			}
+
+			conf, err := sources.AppConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(conf.OutputDirs, []string{tt.wantOutputDir}) {
+				t.Errorf("output directories = %q, want %q", conf.OutputDirs, tt.wantOutputDir)
+			}
+			reportDir := tt.wantReportDir
+			if reportDir == "" {
+				reportDir = tt.wantOutputDir
+			}
+			if want := filepath.Join(reportDir, defaultReportFileName); conf.ReportFile != want {
+				t.Errorf("report file = %q, want %q", conf.ReportFile, want)
+			}
+			if got := conf.API.FilterEndpoint(); got != tt.wantFilter {
+				t.Errorf("FilterEndpoint() = %q, want %q", got, tt.wantFilter)
+			}
+			if got := sources.Source("output_dir"); got != tt.wantSource {
+				t.Errorf("Source(output_dir) = %s, want %s", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestReadSources_NetworkFilterID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CIPHEROWL_CLIENT_ID", "test_client_id")
+	t.Setenv("CIPHEROWL_CLIENT_SECRET", "test_client_secret")
+
+	tests := []struct {
+		name    string
+		content string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "mainnet uses the default filter",
+			content: "network: mainnet\n",
+			want:    "https://svc.cipherowl.ai/api/bloom-filter/file/1",
+		}, {
+			name:    "testnet without filter ID",
+			content: "network: aeneid\n",
+			wantErr: true,
+		}, {
+			name:    "testnet filter ID from the profile",
+			content: "network: aeneid\nnetworks:\n  aeneid:\n    filter_id: \"2\"\n",
+			want:    "https://svc.cipherowl.ai/api/bloom-filter/file/2",
+		}, {
+			name:    "testnet filter ID from the file",
+			content: "network: aeneid\napi:\n  filter_id: \"3\"\n",
+			want:    "https://svc.cipherowl.ai/api/bloom-filter/file/3",
+		}, {
+			name:    "testnet filter ID from the environment",
+			content: "network: aeneid\n",
+			env:     "4",
+			want:    "https://svc.cipherowl.ai/api/bloom-filter/file/4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("CIPHEROWL_API_FILTER_ID", tt.env)
+			}
+			sources, err := ReadSources(writeConfigFile(t, tt.content), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conf, err := sources.AppConfig()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), `network "aeneid" has no default bloom filter ID`) {
+					t.Errorf("AppConfig() error = %v, want the missing filter ID reported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := conf.API.FilterEndpoint(); got != tt.want {
+				t.Errorf("FilterEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSources_UnknownNetwork(t *testing.T) {
+	t.Setenv("CIPHEROWL_CLIENT_ID", "test_client_id")
+	t.Setenv("CIPHEROWL_CLIENT_SECRET", "test_client_secret")
+
+	tests := []struct {
+		network string
+		want    string
+	}{
+		{network: "testnet", want: "expected one of aeneid, devnet, local, mainnet"},
+		{network: "../mainnet", want: "must consist of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			t.Setenv("CIPHEROWL_NETWORK", tt.network)
+			sources, err := ReadSources(writeConfigFile(t, "networks:\n  devnet:\n    filter_id: \"7\"\n"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sources.AppConfig(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("AppConfig() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
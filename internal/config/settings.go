@@ -0,0 +1,119 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+	"github.com/piplabs/story-guardian/internal/report"
+	"github.com/piplabs/story-guardian/utils"
+)
+
+// envPrefix is the prefix of the environment variables overriding the configuration file.
+const envPrefix = "cipherowl"
+
+// Setting documents a configuration key. In the configuration file the dots of the key nest sections, in the
+// environment the key is set by the variable returned by Env.
+type Setting struct {
+	// Key is the dotted configuration key, such as "retry.download.attempts".
+	Key string
+	// Default is the value used when the key is set nowhere.
+	Default any
+	// Description explains the setting in the example configuration file.
+	Description string
+	// Secret marks credentials, which are masked when the configuration is shown.
+	Secret bool
+}
+
+// Env returns the environment variable setting the key, such as CIPHEROWL_RETRY_DOWNLOAD_ATTEMPTS.
+func (s Setting) Env() string {
+	return strings.ToUpper(envPrefix + "_" + strings.ReplaceAll(s.Key, ".", "_"))
+}
+
+// Settings returns every configuration key with its default, in the order of the example configuration file.
+func Settings() []Setting {
+	guardianDir := utils.GetDefaultPath()
+	files := guardianFiles(guardianDir)
+	defaultAPI := DefaultAPIConfig()
+	defaultHTTP := httpclient.DefaultConfig()
+	defaultBreaker := circuitbreaker.DefaultConfig()
+
+	settings := []Setting{
+		{Key: "client_id", Default: "", Secret: true, Description: "CipherOwl client ID."},
+		{Key: "client_secret", Default: "", Secret: true, Description: "CipherOwl client secret."},
+		{Key: "client_id_file", Default: "", Description: "File holding the client ID instead of client_id, re-read when it changes."},
+		{Key: "client_secret_file", Default: "", Description: "File holding the client secret instead of client_secret, re-read when it changes."},
+
+		{Key: "network", Default: "", Description: "Story network (mainnet, aeneid, local or a profile of the networks section) whose profile replaces the defaults of the paths, the filter ID and the endpoints, also set by --network."},
+
+		{Key: "output_dir", Default: []string{files["output_dir"]}, Description: "Directories the bloom filter file is installed into, downloaded once for all of them, also set by --output-dir."},
+		{Key: "report_file", Default: files["report_file"], Description: "Report file of the transactions filtered by geth."},
+
+		{Key: "schedule.time", Default: defaultScheduleTime, Description: "Local time of day (HH:MM) the bloom filter is downloaded."},
+
+		{Key: "api.base_url", Default: defaultAPI.BaseURL, Description: "Root URL the filter and upload paths are resolved against."},
+		{Key: "api.token_url", Default: defaultAPI.TokenURL, Description: "OAuth token endpoint, the token path below the base URL if empty."},
+		{Key: "api.audience", Default: defaultAPI.Audience, Description: "OAuth audience access tokens are requested for."},
+		{Key: "api.filter_path", Default: defaultAPI.FilterPath, Description: "Path of the bloom filter presigned URL endpoint, {filter_id} is replaced by the filter ID."},
+		{Key: "api.filter_id", Default: defaultAPI.FilterID, Description: "Bloom filter of the network, also set by the network profile."},
+		{Key: "api.upload_path", Default: defaultAPI.UploadPath, Description: "Path of the report upload endpoint."},
+
+		{Key: "archive.enabled", Default: false, Description: "Keep a compressed copy of every uploaded report instead of deleting it."},
+		{Key: "archive.dir", Default: files["archive.dir"], Description: "Directory of the report archive."},
+		{Key: "archive.max_age", Default: defaultArchiveMaxAge, Description: "Retention period of archived reports, 0 disables age-based pruning."},
+		{Key: "archive.max_size", Default: int64(defaultArchiveMaxSize), Description: "Total size in bytes the archive may occupy, 0 disables size-based pruning."},
+
+		{Key: "redaction.fields", Default: map[string]string{}, Description: "Report field names mapped to keep, drop, hash or truncate before upload."},
+		{Key: "redaction.salt", Default: "", Secret: true, Description: "Salt prepended to field values before they are hashed."},
+		{Key: "redaction.truncate_length", Default: report.DefaultTruncateLength, Description: "Number of characters kept by the truncate action."},
+
+		{Key: "tail.enabled", Default: false, Description: "Follow the report file and upload new lines continuously."},
+		{Key: "tail.offset_file", Default: files["tail.offset_file"], Description: "File persisting the read position in the report file."},
+		{Key: "tail.batch_size", Default: defaultTailBatchSize, Description: "Size in bytes at which a batch is uploaded without waiting for the flush interval."},
+		{Key: "tail.flush_interval", Default: defaultTailFlushInterval, Description: "Maximum time new lines wait before they are uploaded."},
+
+		{Key: "retry.max_server_delay", Default: defaultRetryMaxServerDelay, Description: "Maximum delay a rate limited or unavailable server may ask for."},
+	}
+	for _, op := range []struct {
+		name   string
+		policy RetryPolicyConfig
+	}{
+		{"download", defaultDownloadRetry},
+		{"upload", defaultUploadRetry},
+		{"token", defaultTokenRetry},
+	} {
+		prefix := "retry." + op.name + "."
+		settings = append(settings,
+			Setting{Key: prefix + "attempts", Default: op.policy.Attempts, Description: "Maximum number of " + op.name + " attempts, including the first."},
+			Setting{Key: prefix + "initial_delay", Default: op.policy.InitialDelay, Description: "Bound of the first backoff, doubling with every attempt."},
+			Setting{Key: prefix + "max_delay", Default: op.policy.MaxDelay, Description: "Maximum bound of the backoff."},
+			Setting{Key: prefix + "max_elapsed", Default: op.policy.MaxElapsed, Description: "Time after the first attempt when retrying stops, 0 disables the limit."},
+		)
+	}
+
+	return append(settings,
+		Setting{Key: "http.proxy", Default: "", Description: "Proxy URL, the HTTPS_PROXY and HTTP_PROXY environment variables if empty."},
+		Setting{Key: "http.no_proxy", Default: []string{}, Description: "Hosts, domains, IP addresses and CIDR ranges contacted without proxy."},
+		Setting{Key: "http.ca_file", Default: "", Description: "PEM bundle of certificate authorities trusted in addition to the system ones."},
+		Setting{Key: "http.cert_file", Default: "", Description: "Client certificate for gateways requiring mutual TLS."},
+		Setting{Key: "http.key_file", Default: "", Description: "Key of the client certificate."},
+		Setting{Key: "http.min_tls_version", Default: defaultHTTPMinTLSVersion, Description: "Minimum TLS version, 1.2 or 1.3."},
+		Setting{Key: "http.timeout", Default: defaultHTTP.Timeout, Description: "Limit of a whole request including its body, 0 disables it."},
+		Setting{Key: "http.dial_timeout", Default: defaultHTTP.DialTimeout, Description: "Limit of establishing a TCP connection."},
+		Setting{Key: "http.tls_handshake_timeout", Default: defaultHTTP.TLSHandshakeTimeout, Description: "Limit of the TLS handshake."},
+		Setting{Key: "http.response_header_timeout", Default: defaultHTTP.ResponseHeaderTimeout, Description: "Limit of waiting for the response headers."},
+		Setting{Key: "http.body_idle_timeout", Default: defaultHTTP.BodyIdleTimeout, Description: "Time a download may deliver no data before it is aborted."},
+		Setting{Key: "http.max_idle_conns", Default: defaultHTTP.MaxIdleConns, Description: "Maximum number of pooled keep-alive connections."},
+		Setting{Key: "http.max_idle_conns_per_host", Default: defaultHTTP.MaxIdleConnsPerHost, Description: "Maximum number of pooled keep-alive connections per host."},
+		Setting{Key: "http.idle_conn_timeout", Default: defaultHTTP.IdleConnTimeout, Description: "Time an idle keep-alive connection is kept."},
+		Setting{Key: "http.debug", Default: false, Description: "Log the timing breakdown of every request."},
+
+		Setting{Key: "circuit_breaker.failure_threshold", Default: defaultBreaker.FailureThreshold, Description: "Consecutive failures opening the breaker of an endpoint, 0 disables the breakers."},
+		Setting{Key: "circuit_breaker.cooldown", Default: defaultBreaker.Cooldown, Description: "Time an open breaker rejects requests before it lets trial requests through."},
+		Setting{Key: "circuit_breaker.half_open_requests", Default: defaultBreaker.HalfOpenRequests, Description: "Successful trial requests needed to close a breaker."},
+
+		Setting{Key: "metrics.listen", Default: "", Description: "Address serving the metrics at /debug/vars, empty disables it."},
+
+		Setting{Key: "reload.watch", Default: false, Description: "Reload the configuration when this file changes, it is always reloaded on SIGHUP."},
+	)
+}
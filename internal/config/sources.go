@@ -0,0 +1,509 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/piplabs/story-guardian/utils"
+)
+
+// Source is where the effective value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	// SourceNetwork is the profile of the selected network, which replaces the defaults.
+	SourceNetwork Source = "network"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources holds the settings merged from the defaults, the configuration file, the environment and the flags.
+type Sources struct {
+	v     *viper.Viper
+	flags *pflag.FlagSet
+	// unknownKeys are the keys of the configuration file that are no setting, such as misspelled ones.
+	unknownKeys []string
+	// networkKeys are the keys whose defaults the profile of the selected network replaced.
+	networkKeys map[string]bool
+	// problems are found while reading the sources, such as an unknown network, and reported by AppConfig.
+	problems []error
+}
+
+// SettingValue is the effective value of a setting.
+type SettingValue struct {
+	Key string `json:"key"`
+	// Value is formatted as in the configuration file, secrets are masked.
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+}
+
+// secretMask replaces the value of a secret setting that is set.
+const secretMask = "********"
+
+// ReadSources reads the configuration file, which is configFile or else the config file in the guardian
+// directory if there is one, and merges it with the defaults, the environment and the flags.
+func ReadSources(configFile string, flags *pflag.FlagSet) (*Sources, error) {
+	v := viper.New()
+	// Set environment variable prefix for configuration
+	v.SetEnvPrefix(envPrefix)
+	// Map nested keys such as "archive.enabled" to CIPHEROWL_ARCHIVE_ENABLED
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	for _, setting := range Settings() {
+		v.SetDefault(setting.Key, setting.Default)
+	}
+	if flags != nil {
+		for key, name := range flagKeys {
+			if flag := flags.Lookup(name); flag != nil {
+				if err := v.BindPFlag(key, flag); err != nil {
+					return nil, fmt.Errorf("failed to bind flag --%s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	if configFile != "" {
+		v.SetConfigFile(expandHome(configFile))
+	} else {
+		v.SetConfigName(DefaultConfigName)
+		v.AddConfigPath(utils.GetDefaultPath())
+	}
+	sources := &Sources{v: v, flags: flags}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if configFile != "" || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+	} else {
+		log.Printf("Read configuration file %s", v.ConfigFileUsed())
+		unknownKeys, err := unknownFileKeys(v.ConfigFileUsed())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+		sources.unknownKeys = unknownKeys
+	}
+
+	// The network is known only now, as it may be selected by the file. Its profile replaces the defaults.
+	if network := v.GetString("network"); network != "" {
+		profile, err := lookupNetwork(v, network)
+		if err != nil {
+			sources.problems = append(sources.problems, err)
+		} else {
+			sources.networkKeys = make(map[string]bool)
+			for key, value := range profile.settings(network) {
+				v.SetDefault(key, value)
+				sources.networkKeys[key] = true
+			}
+			if profile.requireFilterID && sources.Source("api.filter_id") == SourceDefault {
+				sources.problems = append(sources.problems, fmt.Errorf("network %q has no default bloom filter ID, "+
+					"set networks.%s.filter_id or api.filter_id (CIPHEROWL_API_FILTER_ID)", network, network))
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+// unknownFileKeys returns the keys of a configuration file that are no setting. The entries of map settings,
+// such as the redaction fields, and the network profiles are arbitrary.
+func unknownFileKeys(file string) ([]string, error) {
+	fv := viper.New()
+	fv.SetConfigFile(file)
+	if err := fv.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	mapKeys := []string{networksKey + "."}
+	for _, setting := range Settings() {
+		known[setting.Key] = true
+		if _, ok := setting.Default.(map[string]string); ok {
+			mapKeys = append(mapKeys, setting.Key+".")
+		}
+	}
+
+	var unknown []string
+	for _, key := range fv.AllKeys() {
+		if known[key] || slices.ContainsFunc(mapKeys, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	slices.Sort(unknown)
+
+	return unknown, nil
+}
+
+// File returns the configuration file that was read, empty if there is none.
+func (s *Sources) File() string {
+	return s.v.ConfigFileUsed()
+}
+
+// Source returns where the effective value of the setting key comes from.
+func (s *Sources) Source(key string) Source {
+	if name, ok := flagKeys[key]; ok && s.flags != nil {
+		if flag := s.flags.Lookup(name); flag != nil && flag.Changed {
+			return SourceFlag
+		}
+	}
+	// Empty environment variables are ignored like unset ones.
+	if os.Getenv(Setting{Key: key}.Env()) != "" {
+		return SourceEnv
+	}
+	if s.v.InConfig(key) {
+		return SourceFile
+	}
+	if s.networkKeys[key] {
+		return SourceNetwork
+	}
+
+	return SourceDefault
+}
+
+// Values returns the effective value and source of every setting, in the order of Settings. The values of
+// secrets are masked.
+func (s *Sources) Values() []SettingValue {
+	settings := Settings()
+	values := make([]SettingValue, 0, len(settings))
+	for _, setting := range settings {
+		raw := s.value(setting)
+		if str, ok := raw.(string); ok {
+			// The password of a URL, such as that of an authenticating proxy, is masked like a secret.
+			raw = redactURL(str)
+		}
+		value := exampleValue(raw)
+		if setting.Secret && s.v.GetString(setting.Key) != "" {
+			value = secretMask
+		}
+		values = append(values, SettingValue{Key: setting.Key, Value: value, Source: s.Source(setting.Key)})
+	}
+
+	return values
+}
+
+// redactURL masks the password of a URL with credentials. A value that is not a URL is returned unchanged,
+// unless it looks like one with credentials that cannot be parsed.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	switch {
+	case err != nil && strings.Contains(value, "@"):
+		return secretMask
+	case err != nil || u.User == nil:
+		return value
+	default:
+		return u.Redacted()
+	}
+}
+
+// value returns the effective value of a setting, converted to the type of its default.
+func (s *Sources) value(setting Setting) any {
+	switch setting.Default.(type) {
+	case bool:
+		return s.v.GetBool(setting.Key)
+	case int:
+		return s.v.GetInt(setting.Key)
+	case int64:
+		return s.v.GetInt64(setting.Key)
+	case uint:
+		return s.v.GetUint(setting.Key)
+	case time.Duration:
+		return s.v.GetDuration(setting.Key)
+	case []string:
+		return listValue(s.v, setting.Key)
+	case map[string]string:
+		return s.v.GetStringMapString(setting.Key)
+	default:
+		return s.v.GetString(setting.Key)
+	}
+}
+
+// DaemonConfig is AppConfig also requiring the client credentials, which the daemon needs to talk to CipherOwl.
+func (s *Sources) DaemonConfig() (*AppConfig, error) {
+	conf, err := s.AppConfig()
+	problems := Problems(err)
+	credentials := s.credentials()
+	if err := credentials.ValidateCredentials(); err != nil {
+		problems = append([]error{err}, problems...)
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	return conf, nil
+}
+
+// credentials returns a configuration holding only the client credentials.
+func (s *Sources) credentials() AppConfig {
+	return AppConfig{
+		ClientID:         s.v.GetString("client_id"),
+		ClientSecret:     s.v.GetString("client_secret"),
+		ClientIDFile:     expandHome(s.v.GetString("client_id_file")),
+		ClientSecretFile: expandHome(s.v.GetString("client_secret_file")),
+	}
+}
+
+// listValue returns the list setting key. A string, as set by the environment, a scalar of the configuration file
+// or a network profile, is split on commas only, so paths may contain spaces. GetStringSlice would split it on
+// whitespace too.
+func listValue(v *viper.Viper, key string) []string {
+	switch value := v.Get(key).(type) {
+	case string:
+		return splitList([]string{value})
+	case []string:
+		return splitList(value)
+	default:
+		return splitList(cast.ToStringSlice(value))
+	}
+}
+
+// conversionProblems returns a problem for every setting whose value cannot be converted to the type of its
+// default. Viper would silently use the zero value, turning "30 secs" into no timeout at all.
+func (s *Sources) conversionProblems() []error {
+	var problems []error
+	for _, setting := range Settings() {
+		value := s.v.Get(setting.Key)
+		var err error
+		switch setting.Default.(type) {
+		case bool:
+			_, err = cast.ToBoolE(value)
+		case int:
+			_, err = cast.ToIntE(value)
+		case int64:
+			_, err = cast.ToInt64E(value)
+		case uint:
+			_, err = cast.ToUintE(value)
+		case time.Duration:
+			_, err = cast.ToDurationE(value)
+		case map[string]string:
+			_, err = cast.ToStringMapStringE(value)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid value of %s from %s: %w", setting.Key, s.Source(setting.Key), err))
+		}
+	}
+
+	return problems
+}
+
+// Warnings returns the suspicious settings that do not prevent the configuration from being used, such as
+// unknown keys of the configuration file.
+func (s *Sources) Warnings() []string {
+	var warnings []string
+	for _, key := range s.unknownKeys {
+		warnings = append(warnings, fmt.Sprintf("configuration file %s sets unknown key %q", s.File(), key))
+	}
+
+	redaction := RedactionConfig{
+		Fields:         s.v.GetStringMapString("redaction.fields"),
+		Salt:           s.v.GetString("redaction.salt"),
+		TruncateLength: s.v.GetInt("redaction.truncate_length"),
+	}
+	if policy, err := redaction.Policy(); err == nil {
+		for _, field := range policy.UnknownFields() {
+			warnings = append(warnings, fmt.Sprintf("redaction policy refers to unknown report field %q", field))
+		}
+	}
+
+	return warnings
+}
+
+// Problems returns the individual problems of an error returned by Sources.AppConfig.
+func Problems(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// AppConfig validates the settings and returns the configuration. Every problem found is reported, they are
+// joined into the returned error and split again by Problems. The client credentials may be missing, the daemon
+// checks them with AppConfig.ValidateCredentials.
+func (s *Sources) AppConfig() (*AppConfig, error) {
+	v := s.v
+	problems := slices.Clone(s.problems)
+	problems = append(problems, s.conversionProblems()...)
+
+	credentials := s.credentials()
+
+	var outputDirs []string
+	for _, dir := range listValue(v, "output_dir") {
+		dir = filepath.Clean(expandHome(dir))
+		if slices.Contains(outputDirs, dir) {
+			problems = append(problems, fmt.Errorf("output directory %s is listed twice", dir))
+			continue
+		}
+		outputDirs = append(outputDirs, dir)
+	}
+	reportFile := expandHome(v.GetString("report_file"))
+	if len(outputDirs) == 0 || reportFile == "" {
+		problems = append(problems, fmt.Errorf("output directory and report file must not be empty"))
+	}
+
+	schedule := ScheduleConfig{
+		Time: v.GetString("schedule.time"),
+	}
+	if err := schedule.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+
+	api := APIConfig{
+		BaseURL:    v.GetString("api.base_url"),
+		TokenURL:   v.GetString("api.token_url"),
+		Audience:   v.GetString("api.audience"),
+		FilterPath: v.GetString("api.filter_path"),
+		FilterID:   v.GetString("api.filter_id"),
+		UploadPath: v.GetString("api.upload_path"),
+	}
+	if err := api.Validate(); err != nil {
+		problems = append(problems, fmt.Errorf("invalid API configuration: %w", err))
+	}
+
+	archive := ArchiveConfig{
+		Enabled: v.GetBool("archive.enabled"),
+		Dir:     expandHome(v.GetString("archive.dir")),
+		MaxAge:  v.GetDuration("archive.max_age"),
+		MaxSize: v.GetInt64("archive.max_size"),
+	}
+	if archive.Enabled && archive.Dir == "" {
+		problems = append(problems, fmt.Errorf("archive directory must not be empty when archiving is enabled"))
+	}
+	if archive.MaxAge < 0 || archive.MaxSize < 0 {
+		problems = append(problems, fmt.Errorf("archive retention limits must not be negative"))
+	}
+
+	redaction := RedactionConfig{
+		Fields:         v.GetStringMapString("redaction.fields"),
+		Salt:           v.GetString("redaction.salt"),
+		TruncateLength: v.GetInt("redaction.truncate_length"),
+	}
+	if _, err := redaction.Policy(); err != nil {
+		problems = append(problems, fmt.Errorf("invalid redaction policy: %w", err))
+	}
+
+	tail := TailConfig{
+		Enabled:       v.GetBool("tail.enabled"),
+		OffsetFile:    expandHome(v.GetString("tail.offset_file")),
+		BatchSize:     v.GetInt("tail.batch_size"),
+		FlushInterval: v.GetDuration("tail.flush_interval"),
+	}
+	if tail.Enabled && (tail.OffsetFile == "" || tail.BatchSize <= 0 || tail.FlushInterval <= 0) {
+		problems = append(problems, fmt.Errorf("tail mode requires an offset file, a positive batch size and a positive flush interval"))
+	}
+
+	retry := RetryConfig{
+		MaxServerDelay: v.GetDuration("retry.max_server_delay"),
+		Download:       retryPolicyConfig(v, "retry.download"),
+		Upload:         retryPolicyConfig(v, "retry.upload"),
+		Token:          retryPolicyConfig(v, "retry.token"),
+	}
+	if retry.MaxServerDelay < 0 {
+		problems = append(problems, fmt.Errorf("maximum server retry delay must not be negative"))
+	}
+	for _, op := range []struct {
+		name   string
+		policy RetryPolicyConfig
+	}{
+		{"download", retry.Download},
+		{"upload", retry.Upload},
+		{"token", retry.Token},
+	} {
+		if err := op.policy.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid %s retry policy: %w", op.name, err))
+		}
+	}
+
+	httpConf := HTTPConfig{
+		Proxy:         v.GetString("http.proxy"),
+		NoProxy:       listValue(v, "http.no_proxy"),
+		CAFile:        expandHome(v.GetString("http.ca_file")),
+		CertFile:      expandHome(v.GetString("http.cert_file")),
+		KeyFile:       expandHome(v.GetString("http.key_file")),
+		MinTLSVersion: v.GetString("http.min_tls_version"),
+
+		Timeout:               v.GetDuration("http.timeout"),
+		DialTimeout:           v.GetDuration("http.dial_timeout"),
+		TLSHandshakeTimeout:   v.GetDuration("http.tls_handshake_timeout"),
+		ResponseHeaderTimeout: v.GetDuration("http.response_header_timeout"),
+		BodyIdleTimeout:       v.GetDuration("http.body_idle_timeout"),
+		MaxIdleConns:          v.GetInt("http.max_idle_conns"),
+		MaxIdleConnsPerHost:   v.GetInt("http.max_idle_conns_per_host"),
+		IdleConnTimeout:       v.GetDuration("http.idle_conn_timeout"),
+		Debug:                 v.GetBool("http.debug"),
+	}
+	if httpConf.Proxy != "" {
+		if u, err := url.Parse(httpConf.Proxy); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			problems = append(problems, fmt.Errorf("proxy %q must be an http, https or socks5 URL", redactURL(httpConf.Proxy)))
+		}
+	}
+	if (httpConf.CertFile == "") != (httpConf.KeyFile == "") {
+		problems = append(problems, fmt.Errorf("client certificate requires both a certificate and a key file"))
+	}
+	if _, err := httpConf.ClientConfig(); err != nil {
+		problems = append(problems, fmt.Errorf("invalid HTTP configuration: %w", err))
+	}
+	if httpConf.Timeout < 0 || httpConf.DialTimeout < 0 || httpConf.TLSHandshakeTimeout < 0 ||
+		httpConf.ResponseHeaderTimeout < 0 || httpConf.BodyIdleTimeout < 0 || httpConf.IdleConnTimeout < 0 ||
+		httpConf.MaxIdleConns < 0 || httpConf.MaxIdleConnsPerHost < 0 {
+		problems = append(problems, fmt.Errorf("HTTP timeouts and connection limits must not be negative"))
+	}
+
+	circuitBreaker := CircuitBreakerConfig{
+		FailureThreshold: v.GetInt("circuit_breaker.failure_threshold"),
+		Cooldown:         v.GetDuration("circuit_breaker.cooldown"),
+		HalfOpenRequests: v.GetInt("circuit_breaker.half_open_requests"),
+	}
+	if circuitBreaker.FailureThreshold < 0 || circuitBreaker.Cooldown < 0 || circuitBreaker.HalfOpenRequests < 0 {
+		problems = append(problems, fmt.Errorf("circuit breaker thresholds and cooldown must not be negative"))
+	}
+
+	metrics := MetricsConfig{
+		Listen: v.GetString("metrics.listen"),
+	}
+
+	reload := ReloadConfig{
+		Watch: v.GetBool("reload.watch"),
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	return &AppConfig{
+		ClientID:         credentials.ClientID,
+		ClientSecret:     credentials.ClientSecret,
+		ClientIDFile:     credentials.ClientIDFile,
+		ClientSecretFile: credentials.ClientSecretFile,
+		Network:          v.GetString("network"),
+		OutputDirs:       outputDirs,
+		ReportFile:       reportFile,
+		Schedule:         schedule,
+		API:              api,
+		Archive:          archive,
+		Redaction:        redaction,
+		Tail:             tail,
+		Retry:            retry,
+		HTTP:             httpConf,
+		CircuitBreaker:   circuitBreaker,
+		Metrics:          metrics,
+		Reload:           reload,
+	}, nil
+}
@@ -3,52 +3,118 @@ package internal
 import (
 	"context"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 
-	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
 )
 
 const (
 	bloomFilterFilename = "bloom_filter.gob"
+
+	// bloomFilterMode is the permission of installed bloom filter files, readable by geth running as another user.
+	bloomFilterMode = 0644
 )
 
+// InstallResult is the outcome of installing the bloom filter file into one output directory.
+type InstallResult struct {
+	Dir string
+	// Err is nil if the filter was installed.
+	Err error
+}
+
 // DownloadAndSaveBloomFilter retrieves and saves the bloom filter file to the specified location.
-func DownloadAndSaveBloomFilter(ctx context.Context, outputDir string) error {
-	// Ensure the output directory exists
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return err
-		}
+func DownloadAndSaveBloomFilter(ctx context.Context, api cipherowl.API, outputDir string) error {
+	stagedPath, err := DownloadBloomFilter(ctx, api)
+	if err != nil {
+		return err
 	}
+	defer os.Remove(stagedPath)
+
+	return InstallBloomFilter(stagedPath, []string{outputDir})[0].Err
+}
 
+// DownloadBloomFilter downloads the bloom filter file into a temporary file and returns its path. The caller
+// installs it with InstallBloomFilter and removes it afterwards.
+func DownloadBloomFilter(ctx context.Context, api cipherowl.API) (string, error) {
 	// Retrieve presigned file URL
-	presignedURL, err := fetchBloomFilterPresignedURL(ctx)
+	presignedURL, err := api.FetchBloomFilterURL(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Use the default HTTP client from the httpclient package
-	client := httpclient.DefaultClient()
+	body, err := api.DownloadFile(ctx, presignedURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
 
-	resp, err := client.Do(ctx, http.MethodGet, presignedURL, nil, nil)
+	file, err := os.CreateTemp("", "bloom_filter-*.gob")
 	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// InstallBloomFilter copies a downloaded bloom filter file into every output directory, creating missing ones.
+// Each copy is written to a temporary file in its directory and renamed over the previous filter, so a reader
+// sees either the previous or the new filter, never a partial one. A failed directory does not stop the others.
+func InstallBloomFilter(stagedPath string, outputDirs []string) []InstallResult {
+	results := make([]InstallResult, 0, len(outputDirs))
+	for _, dir := range outputDirs {
+		results = append(results, InstallResult{Dir: dir, Err: installFile(stagedPath, dir)})
+	}
+
+	return results
+}
+
+// installFile atomically replaces the bloom filter file of dir with a copy of stagedPath.
+func installFile(stagedPath, dir string) (err error) {
+	// Ensure the output directory exists
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	// Save file to output directory
-	filePath := filepath.Join(outputDir, bloomFilterFilename)
-	file, err := os.Create(filePath)
+	src, err := os.Open(stagedPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer src.Close()
 
-	if _, err := io.Copy(file, resp.Body); err != nil {
+	// The temporary file is in the target directory, so the rename does not cross file systems.
+	tmp, err := os.CreateTemp(dir, "."+bloomFilterFilename+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(bloomFilterMode); err != nil {
+		return err
+	}
+	// Flush the contents before the rename makes them visible, so a crash cannot leave a truncated filter.
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(tmp.Name(), filepath.Join(dir, bloomFilterFilename))
 }
@@ -2,22 +2,16 @@ package internal
 
 import (
 	"context"
-	"net/http"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
-	"github.com/jarcoal/httpmock"
-
-	"github.com/piplabs/story-guardian/utils/ctxutil"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
 )
 
 func TestDownloader_DownloadAndSaveBloomFilter(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	ctx := context.Background()
-	ctxutil.WithAccessToken(ctx, "test_access_token")
 
 	type args struct {
 		ctx       context.Context
@@ -28,7 +22,7 @@ func TestDownloader_DownloadAndSaveBloomFilter(t *testing.T) {
 		args    args
 		want    string
 		wantErr bool
-		mock    func()
+		mock    func(api *cipherowl.Fake)
 	}{
 		{
 			name: "successful download and save",
@@ -38,13 +32,6 @@ func TestDownloader_DownloadAndSaveBloomFilter(t *testing.T) {
 			},
 			want:    "bloom_filter_data",
 			wantErr: false,
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodGet, BloomFilterFileURL,
-					httpmock.NewStringResponder(http.StatusOK, `{"presignedUrl": "test_presigned_url"}`))
-
-				httpmock.RegisterResponder(http.MethodGet, "test_presigned_url",
-					httpmock.NewStringResponder(http.StatusOK, "bloom_filter_data"))
-			},
 		},
 		{
 			name: "network error in downloading",
@@ -53,21 +40,19 @@ func TestDownloader_DownloadAndSaveBloomFilter(t *testing.T) {
 				outputDir: os.TempDir(),
 			},
 			wantErr: true,
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodGet, BloomFilterFileURL,
-					httpmock.NewStringResponder(http.StatusOK, `{"presignedUrl": "test_presigned_url"}`))
-
-				httpmock.RegisterResponder(http.MethodGet, "test_presigned_url",
-					httpmock.NewErrorResponder(http.ErrServerClosed))
+			mock: func(api *cipherowl.Fake) {
+				api.DownloadErr = errors.New("connection reset by peer")
 			},
 		},
 	}
 	for _, tt := range tests {
-		if tt.mock != nil {
-			tt.mock()
-		}
 		t.Run(tt.name, func(t *testing.T) {
-			if err := DownloadAndSaveBloomFilter(tt.args.ctx, tt.args.outputDir); (err != nil) != tt.wantErr {
+			api := cipherowl.NewFake([]byte("bloom_filter_data"))
+			if tt.mock != nil {
+				tt.mock(api)
+			}
+
+			if err := DownloadAndSaveBloomFilter(tt.args.ctx, api, tt.args.outputDir); (err != nil) != tt.wantErr {
 				t.Errorf("DownloadAndSaveBloomFilter() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
@@ -91,3 +76,46 @@ func TestDownloader_DownloadAndSaveBloomFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestInstallBloomFilter(t *testing.T) {
+	staged := filepath.Join(t.TempDir(), "staged.gob")
+	if err := os.WriteFile(staged, []byte("new_filter"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	existing := filepath.Join(root, "archive")
+	if err := os.MkdirAll(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(existing, bloomFilterFilename), []byte("old_filter"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "rpc", "guardian")
+	// A regular file in place of the directory cannot hold the filter.
+	blocked := filepath.Join(root, "blocked")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := InstallBloomFilter(staged, []string{existing, blocked, missing})
+	if len(results) != 3 {
+		t.Fatalf("InstallBloomFilter() returned %d results, want 3", len(results))
+	}
+	for _, result := range results {
+		if wantErr := result.Dir == blocked; (result.Err != nil) != wantErr {
+			t.Errorf("result of %s error = %v, wantErr %v", result.Dir, result.Err, wantErr)
+		}
+	}
+
+	for _, dir := range []string{existing, missing} {
+		content, err := os.ReadFile(filepath.Join(dir, bloomFilterFilename))
+		if err != nil || string(content) != "new_filter" {
+			t.Errorf("filter of %s = %q, %v, want the new filter", dir, content, err)
+		}
+		// The temporary file was renamed, nothing else is left behind.
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("%s holds %d files, want only the filter", dir, len(entries))
+		}
+	}
+}
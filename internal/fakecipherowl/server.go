@@ -0,0 +1,379 @@
+// Package fakecipherowl implements an in-process CipherOwl API server for local integration testing.
+// It serves the OAuth token endpoint, the bloom filter presigned URL endpoint, the presigned file
+// download and the report upload, and records every accepted upload.
+package fakecipherowl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand/v2"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/config"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// Endpoints of the fake server, used to target injected failures.
+const (
+	EndpointToken    = "token"
+	EndpointFilter   = "filter"
+	EndpointDownload = "download"
+	EndpointUpload   = "upload"
+)
+
+const (
+	// DownloadPath is the path of the presigned bloom filter download.
+	DownloadPath = "/files/bloom_filter.gob"
+
+	defaultTokenTTL      = time.Hour
+	defaultFailureStatus = http.StatusServiceUnavailable
+	maxUploadSize        = 32 << 20 // 32 MiB
+)
+
+// Config configures a Server.
+type Config struct {
+	// ClientID and ClientSecret are the accepted credentials. Any credentials are accepted if both are empty.
+	ClientID     string
+	ClientSecret string
+	// Filter is the content of the bloom filter file.
+	Filter []byte
+	// TokenTTL is the lifetime of issued access tokens, one hour by default.
+	TokenTTL time.Duration
+	// Latency delays every response.
+	Latency time.Duration
+	// FailureRate is the fraction of requests, between 0 and 1, answered with FailureStatus.
+	FailureRate float64
+	// FailureStatus is the status of injected failures, 503 by default.
+	FailureStatus int
+	// Logger logs every request if set.
+	Logger *log.Logger
+}
+
+// Upload is a report batch received by the server.
+type Upload struct {
+	BatchID     string
+	ReceiptID   string
+	FileName    string
+	ContentType string
+	Body        []byte
+	ReceivedAt  time.Time
+	// Duplicates counts the later uploads with the same idempotency key.
+	Duplicates int
+}
+
+// failure is a failure injected for the next requests to an endpoint.
+type failure struct {
+	remaining int
+	status    int
+}
+
+// Server is a fake CipherOwl API. It is safe for concurrent use.
+type Server struct {
+	mu       sync.Mutex
+	cfg      Config
+	tokens   map[string]time.Time
+	uploads  []Upload
+	failures map[string]*failure
+	requests map[string]int
+	mux      *http.ServeMux
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// New creates a Server serving the API paths of the default CipherOwl configuration.
+func New(cfg Config) *Server {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = defaultTokenTTL
+	}
+	if cfg.FailureStatus == 0 {
+		cfg.FailureStatus = defaultFailureStatus
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		tokens:   make(map[string]time.Time),
+		failures: make(map[string]*failure),
+		requests: make(map[string]int),
+		mux:      http.NewServeMux(),
+	}
+	s.handle(EndpointToken, http.MethodPost, "/"+config.DefaultAPITokenPath, s.handleToken)
+	s.handle(EndpointFilter, http.MethodGet, "/"+config.DefaultAPIFilterPath, s.authorized(s.handleFilter))
+	s.handle(EndpointDownload, http.MethodGet, DownloadPath, s.handleDownload)
+	s.handle(EndpointUpload, http.MethodPost, "/"+config.DefaultAPIUploadPath, s.authorized(s.handleUpload))
+
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetFilter replaces the content of the bloom filter file.
+func (s *Server) SetFilter(filter []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg.Filter = filter
+}
+
+// SetLatency changes the delay of every response.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg.Latency = latency
+}
+
+// FailNext answers the next n requests to the endpoint with the given status.
+func (s *Server) FailNext(endpoint string, n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[endpoint] = &failure{remaining: n, status: status}
+}
+
+// RevokeTokens invalidates every issued access token, as if they were revoked before their expiry.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.tokens)
+}
+
+// Uploads returns the accepted report batches in the order they were first received.
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.uploads)
+}
+
+// Requests returns the number of requests received by the endpoint, including failed ones.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// handle registers an endpoint handler wrapped with latency, failure injection and logging.
+func (s *Server) handle(endpoint, method, path string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(method+" "+path, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[endpoint]++
+		latency := s.cfg.Latency
+		status := s.injectedFailure(endpoint)
+		logger := s.cfg.Logger
+		s.mu.Unlock()
+
+		if logger != nil {
+			logger.Printf("fake-server: %s %s", r.Method, r.URL.Path)
+		}
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status != 0 {
+			writeError(w, status, "injected_failure", fmt.Sprintf("injected failure of the %s endpoint", endpoint))
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
+// injectedFailure returns the status of a failure injected for the request, or 0. The caller holds s.mu.
+func (s *Server) injectedFailure(endpoint string) int {
+	if f := s.failures[endpoint]; f != nil && f.remaining > 0 {
+		f.remaining--
+		return f.status
+	}
+	if s.cfg.FailureRate > 0 && mathrand.Float64() < s.cfg.FailureRate {
+		return s.cfg.FailureStatus
+	}
+
+	return 0
+}
+
+// authorized rejects requests without a valid access token.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get(httpclient.AuthorizationHeader), "Bearer ")
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid_token", "missing bearer token")
+			return
+		}
+
+		s.mu.Lock()
+		expiry, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok || time.Now().After(expiry) {
+			writeError(w, http.StatusUnauthorized, "invalid_token", "unknown or expired access token")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// handleToken issues an access token for the client credentials grant.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		GrantType    string `json:"grant_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if req.GrantType != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", req.GrantType)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if (s.cfg.ClientID != "" || s.cfg.ClientSecret != "") &&
+		(req.ClientID != s.cfg.ClientID || req.ClientSecret != s.cfg.ClientSecret) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "unknown client credentials")
+		return
+	}
+
+	token := randomID()
+	s.tokens[token] = time.Now().Add(s.cfg.TokenTTL)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"expires_in":   int(s.cfg.TokenTTL.Seconds()),
+		"token_type":   "Bearer",
+	})
+}
+
+// handleFilter returns a presigned URL of the bloom filter file pointing back to this server.
+func (s *Server) handleFilter(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"presignedUrl": fmt.Sprintf("%s://%s%s?X-Signature=%s", scheme, r.Host, DownloadPath, randomID()),
+	})
+}
+
+// handleDownload serves the bloom filter file. Like a real presigned URL, it requires a signature but no token.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("X-Signature") == "" {
+		writeError(w, http.StatusForbidden, "access_denied", "missing signature")
+		return
+	}
+
+	s.mu.Lock()
+	filter := s.cfg.Filter
+	s.mu.Unlock()
+
+	w.Header().Set(httpclient.ContentTypeHeader, "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(filter)
+}
+
+// handleUpload records a report batch. A batch is accepted once per idempotency key, later uploads are
+// answered with the receipt of the first one.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	fileName, body, err := readUploadedFile(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+
+	batchID := r.Header.Get(httpclient.IdempotencyKeyHeader)
+	if batchID == "" {
+		batchID = randomID()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.uploads, func(u Upload) bool { return u.BatchID == batchID }); i >= 0 {
+		s.uploads[i].Duplicates++
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate", "id": s.uploads[i].ReceiptID})
+		return
+	}
+
+	upload := Upload{
+		BatchID:     batchID,
+		ReceiptID:   randomID(),
+		FileName:    fileName,
+		ContentType: r.Header.Get(httpclient.ContentTypeHeader),
+		Body:        body,
+		ReceivedAt:  time.Now().UTC(),
+	}
+	s.uploads = append(s.uploads, upload)
+	if s.cfg.Logger != nil {
+		s.cfg.Logger.Printf("fake-server: accepted report batch %s with %d bytes", batchID, len(body))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "id": upload.ReceiptID})
+}
+
+// readUploadedFile returns the name and the content of the "file" part of a multipart upload.
+func readUploadedFile(r *http.Request) (string, []byte, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get(httpclient.ContentTypeHeader))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return "", nil, fmt.Errorf("expected a multipart body, got %q", r.Header.Get(httpclient.ContentTypeHeader))
+	}
+
+	mr := multipart.NewReader(io.LimitReader(r.Body, maxUploadSize), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return "", nil, fmt.Errorf("missing file part: %w", err)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return part.FileName(), body, nil
+	}
+}
+
+// writeJSON writes v as JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set(httpclient.ContentTypeHeader, httpclient.ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an OAuth style JSON error response.
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// randomID returns a random hex identifier for tokens, signatures and receipts.
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
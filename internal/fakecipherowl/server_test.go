@@ -0,0 +1,158 @@
+package fakecipherowl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/piplabs/story-guardian/internal"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+const testReportLine = "timestamp: 2024-11-14T17:14:05+08:00, filtered_address: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, tx_hash: 0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85, type: 0, from: 0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58, to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, value: 0, nonce: 0, gas: 0, gas_price: 0\n"
+
+// startServer starts a fake server and returns a client authenticated with the given credentials.
+func startServer(t *testing.T, cfg Config, clientID, clientSecret string) (*Server, *cipherowl.Client) {
+	t.Helper()
+
+	fake := New(cfg)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, cipherowl.NewClient(
+		cipherowl.WithBaseURL(server.URL),
+		cipherowl.WithCredentials(clientID, clientSecret),
+	)
+}
+
+func TestServer_DownloadAndUpload(t *testing.T) {
+	fake, client := startServer(t, Config{
+		ClientID:     "test_client_id",
+		ClientSecret: "test_client_secret",
+		Filter:       []byte("bloom_filter_data"),
+	}, "test_client_id", "test_client_secret")
+
+	outputDir := t.TempDir()
+	if err := internal.DownloadAndSaveBloomFilter(context.Background(), client, outputDir); err != nil {
+		t.Fatalf("DownloadAndSaveBloomFilter() error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, "bloom_filter.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "bloom_filter_data" {
+		t.Errorf("downloaded filter = %q, want %q", content, "bloom_filter_data")
+	}
+
+	reportFilePath := filepath.Join(t.TempDir(), "filtered_report.log")
+	if err := os.WriteFile(reportFilePath, []byte(testReportLine), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.UploadReportFile(context.Background(), client, reportFilePath); err != nil {
+		t.Fatalf("UploadReportFile() error = %v", err)
+	}
+
+	uploads := fake.Uploads()
+	if len(uploads) != 1 {
+		t.Fatalf("server received %d uploads, want 1", len(uploads))
+	}
+	if string(uploads[0].Body) != testReportLine {
+		t.Errorf("uploaded body = %q, want %q", uploads[0].Body, testReportLine)
+	}
+	if uploads[0].BatchID == "" {
+		t.Errorf("upload has no idempotency key")
+	}
+	if got := fake.Requests(EndpointToken); got != 1 {
+		t.Errorf("token endpoint received %d requests, want 1", got)
+	}
+}
+
+func TestServer_Failures(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientID   string
+		mock       func(fake *Server)
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "rejected credentials",
+			clientID:   "unknown_client_id",
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_client",
+		},
+		{
+			name:     "injected failure",
+			clientID: "test_client_id",
+			mock: func(fake *Server) {
+				fake.FailNext(EndpointFilter, 1, http.StatusBadGateway)
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   "injected_failure",
+		},
+		{
+			name:     "failure rate",
+			clientID: "test_client_id",
+			mock: func(fake *Server) {
+				fake.cfg.FailureRate = 1
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "injected_failure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := startServer(t, Config{
+				ClientID:     "test_client_id",
+				ClientSecret: "test_client_secret",
+			}, tt.clientID, "test_client_secret")
+			if tt.mock != nil {
+				tt.mock(fake)
+			}
+
+			_, err := client.FetchBloomFilterURL(context.Background())
+			var apiErr *httpclient.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("FetchBloomFilterURL() error = %v, want an APIError", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.Code != tt.wantCode {
+				t.Errorf("FetchBloomFilterURL() error = %v, want status %d and code %s", err, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServer_DuplicateUpload(t *testing.T) {
+	fake, client := startServer(t, Config{}, "any_client_id", "any_client_secret")
+
+	// The token is revoked between the uploads, the client must fetch a new one transparently.
+	first, err := client.UploadReport(context.Background(), "test_batch_id", multipartBody, multipartContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.RevokeTokens()
+	second, err := client.UploadReport(context.Background(), "test_batch_id", multipartBody, multipartContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Status != "success" || second.Status != "duplicate" || first.ReceiptID != second.ReceiptID {
+		t.Errorf("receipts = %+v and %+v, want success and duplicate with the same receipt ID", first, second)
+	}
+	if uploads := fake.Uploads(); len(uploads) != 1 || uploads[0].Duplicates != 1 {
+		t.Errorf("uploads = %+v, want one upload with one duplicate", uploads)
+	}
+}
+
+const multipartContentType = "multipart/form-data; boundary=test_boundary"
+
+// multipartBody is a multipart body with a single report file part.
+var multipartBody = []byte("--test_boundary\r\n" +
+	"Content-Disposition: form-data; name=\"file\"; filename=\"batch.log\"\r\n\r\n" +
+	testReportLine +
+	"\r\n--test_boundary--\r\n")
@@ -0,0 +1,299 @@
+// Package circuitbreaker stops calling an endpoint that keeps failing, so clients back off together while it is
+// down and probe it carefully once it may have recovered.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default breaker settings.
+const (
+	DefaultFailureThreshold = 5
+	DefaultCooldown         = time.Minute
+	DefaultHalfOpenRequests = 1
+)
+
+// ErrOpen is returned, wrapped in an *OpenError, for calls rejected by an open breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a breaker.
+type State int
+
+const (
+	// Closed lets every call through and counts consecutive failures.
+	Closed State = iota
+	// Open rejects every call until the cooldown has passed.
+	Open
+	// HalfOpen lets a limited number of trial calls through, closing the breaker if they succeed and opening it
+	// again if one fails.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Config configures the breakers of a Set.
+type Config struct {
+	// FailureThreshold is the number of consecutive failures opening a breaker, zero disables the breakers.
+	FailureThreshold int
+	// Cooldown is how long an open breaker rejects calls before it lets trial calls through.
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of trial calls that must succeed to close a half-open breaker.
+	HalfOpenRequests int
+}
+
+// DefaultConfig returns the default breaker configuration.
+func DefaultConfig() Config {
+	return Config{
+		FailureThreshold: DefaultFailureThreshold,
+		Cooldown:         DefaultCooldown,
+		HalfOpenRequests: DefaultHalfOpenRequests,
+	}
+}
+
+// OpenError is the error of a call rejected by an open breaker.
+type OpenError struct {
+	// Endpoint is the name of the breaker.
+	Endpoint string
+	// RetryAfter is the time left until the breaker lets trial calls through.
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open, retry in %s", e.Endpoint, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrOpen.
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Status is a snapshot of a breaker.
+type Status struct {
+	Endpoint string    `json:"endpoint"`
+	State    string    `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	OpenedAt time.Time `json:"opened_at"`
+	// Opened counts how often the breaker opened.
+	Opened int64 `json:"opened_total"`
+}
+
+// Breaker guards the calls to one endpoint. It is safe for concurrent use.
+type Breaker struct {
+	name     string
+	cfg      Config
+	now      func() time.Time
+	onChange func(name string, from, to State)
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	trials    int
+	openedAt  time.Time
+	opened    int64
+}
+
+// Allow reports whether a call may be made, returning an *OpenError if not. Every allowed call must be followed
+// by a call to Done with its outcome, or to Skip.
+func (b *Breaker) Allow() error {
+	if b.cfg.FailureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if wait := b.openedAt.Add(b.cfg.Cooldown).Sub(b.now()); wait > 0 {
+			return &OpenError{Endpoint: b.name, RetryAfter: wait}
+		}
+		b.setState(HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return &OpenError{Endpoint: b.name}
+		}
+		b.trials++
+	}
+
+	return nil
+}
+
+// Done records the outcome of a call allowed by Allow.
+func (b *Breaker) Done(success bool) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	case HalfOpen:
+		b.releaseTrial()
+		if !success {
+			b.failures++
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.failures = 0
+			b.setState(Closed)
+		}
+	case Open:
+		// A call allowed before the breaker opened, its outcome no longer matters.
+	}
+}
+
+// Skip releases a call allowed by Allow without recording its outcome, such as a call canceled by the caller.
+func (b *Breaker) Skip() {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.releaseTrial()
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Status returns a snapshot of the breaker.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Status{
+		Endpoint: b.name,
+		State:    b.state.String(),
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+		Opened:   b.opened,
+	}
+}
+
+// releaseTrial ends a half-open trial call. Calls allowed before the breaker became half-open are not counted
+// as trials. The caller holds the lock.
+func (b *Breaker) releaseTrial() {
+	if b.trials > 0 {
+		b.trials--
+	}
+}
+
+// open opens the breaker. The caller holds the lock.
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.opened++
+	b.setState(Open)
+}
+
+// setState moves the breaker to state and resets the half-open bookkeeping. The caller holds the lock.
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.successes = 0
+	b.trials = 0
+	if state == Closed {
+		b.openedAt = time.Time{}
+	}
+	if from != state && b.onChange != nil {
+		b.onChange(b.name, from, state)
+	}
+}
+
+// Set holds one breaker per endpoint, created on first use. It is safe for concurrent use.
+type Set struct {
+	cfg      Config
+	now      func() time.Time
+	onChange func(name string, from, to State)
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet creates a Set of breakers with the given configuration. A zero cooldown or number of half-open requests
+// takes the default. onChange, if not nil, is called on every state change while the breaker is locked, it
+// must not call the breaker.
+func NewSet(cfg Config, onChange func(endpoint string, from, to State)) *Set {
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+
+	return &Set{
+		cfg:      cfg,
+		now:      time.Now,
+		onChange: onChange,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of endpoint.
+func (s *Set) Get(endpoint string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[endpoint]
+	if !ok {
+		b = &Breaker{name: endpoint, cfg: s.cfg, now: s.now, onChange: s.onChange}
+		s.breakers[endpoint] = b
+	}
+
+	return b
+}
+
+// Statuses returns a snapshot of every breaker, sorted by endpoint.
+func (s *Set) Statuses() []Status {
+	s.mu.Lock()
+	breakers := make([]*Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+
+	return statuses
+}
@@ -0,0 +1,164 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestSet returns a Set with a clock controlled by the test and the recorded state changes.
+func newTestSet(cfg Config, now *time.Time) (*Set, *[]string) {
+	var changes []string
+	set := NewSet(cfg, func(endpoint string, from, to State) {
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+	set.now = func() time.Time { return *now }
+
+	return set, &changes
+}
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		advance   time.Duration
+		success   bool
+		wantOpen  bool
+		wantState State
+	}
+	tests := []struct {
+		name        string
+		cfg         Config
+		steps       []step
+		wantChanges int
+	}{
+		{
+			name: "opens after consecutive failures",
+			cfg:  Config{FailureThreshold: 3, Cooldown: time.Minute},
+			steps: []step{
+				{success: false, wantState: Closed},
+				{success: false, wantState: Closed},
+				{success: false, wantState: Open},
+				{wantOpen: true, wantState: Open},
+			},
+			wantChanges: 1,
+		},
+		{
+			name: "success resets the failure count",
+			cfg:  Config{FailureThreshold: 2, Cooldown: time.Minute},
+			steps: []step{
+				{success: false, wantState: Closed},
+				{success: true, wantState: Closed},
+				{success: false, wantState: Closed},
+			},
+		},
+		{
+			name: "half-open trial closes the breaker",
+			cfg:  Config{FailureThreshold: 1, Cooldown: time.Minute},
+			steps: []step{
+				{success: false, wantState: Open},
+				{advance: 30 * time.Second, wantOpen: true, wantState: Open},
+				{advance: 30 * time.Second, success: true, wantState: Closed},
+			},
+			wantChanges: 3,
+		},
+		{
+			name: "failed trial opens the breaker again",
+			cfg:  Config{FailureThreshold: 1, Cooldown: time.Minute},
+			steps: []step{
+				{success: false, wantState: Open},
+				{advance: time.Minute, success: false, wantState: Open},
+				{advance: 59 * time.Second, wantOpen: true, wantState: Open},
+			},
+			wantChanges: 3,
+		},
+		{
+			name: "several trials needed to close",
+			cfg:  Config{FailureThreshold: 1, Cooldown: time.Minute, HalfOpenRequests: 2},
+			steps: []step{
+				{success: false, wantState: Open},
+				{advance: time.Minute, success: true, wantState: HalfOpen},
+				{success: true, wantState: Closed},
+			},
+			wantChanges: 3,
+		},
+		{
+			name: "disabled",
+			cfg:  Config{FailureThreshold: 0},
+			steps: []step{
+				{success: false, wantState: Closed},
+				{success: false, wantState: Closed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			set, changes := newTestSet(tt.cfg, &now)
+			breaker := set.Get("svc.cipherowl.ai/oauth/token")
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				err := breaker.Allow()
+				if gotOpen := errors.Is(err, ErrOpen); gotOpen != s.wantOpen {
+					t.Fatalf("step %d: Allow() error = %v, want open %v", i, err, s.wantOpen)
+				}
+				if err == nil {
+					breaker.Done(s.success)
+				}
+				if got := breaker.State(); got != s.wantState {
+					t.Fatalf("step %d: State() = %v, want %v", i, got, s.wantState)
+				}
+			}
+			if len(*changes) != tt.wantChanges {
+				t.Errorf("state changes = %v, want %d", *changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestBreaker_HalfOpenLimitsTrials(t *testing.T) {
+	now := time.Now()
+	set, _ := newTestSet(Config{FailureThreshold: 1, Cooldown: time.Minute}, &now)
+	breaker := set.Get("svc.cipherowl.ai/api/upload/report/v1")
+
+	breaker.Allow()
+	breaker.Done(false)
+	now = now.Add(time.Minute)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("first trial Allow() error = %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second concurrent trial Allow() error = %v, want ErrOpen", err)
+	}
+
+	// A skipped trial frees its slot without closing the breaker.
+	breaker.Skip()
+	if got := breaker.State(); got != HalfOpen {
+		t.Errorf("State() after Skip() = %v, want half-open", got)
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Allow() after Skip() error = %v", err)
+	}
+}
+
+func TestSet_Statuses(t *testing.T) {
+	now := time.Now()
+	set, _ := newTestSet(Config{FailureThreshold: 1, Cooldown: time.Minute}, &now)
+
+	set.Get("svc.cipherowl.ai/oauth/token").Allow()
+	set.Get("svc.cipherowl.ai/oauth/token").Done(true)
+	set.Get("svc.cipherowl.ai/api/bloom-filter/file/1").Allow()
+	set.Get("svc.cipherowl.ai/api/bloom-filter/file/1").Done(false)
+
+	statuses := set.Statuses()
+	if len(statuses) != 2 {
+		t.Fatalf("Statuses() = %+v, want 2 breakers", statuses)
+	}
+	filter, token := statuses[0], statuses[1]
+	if filter.State != "open" || filter.Opened != 1 || !filter.OpenedAt.Equal(now) {
+		t.Errorf("filter breaker = %+v, want open since now", filter)
+	}
+	if token.State != "closed" || token.Failures != 0 {
+		t.Errorf("token breaker = %+v, want closed", token)
+	}
+}
@@ -0,0 +1,91 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader provides a client certificate and loads it again once the certificate or key file changes,
+// so a renewed certificate is used for new connections without a restart. It is safe for concurrent use.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// newCertReloader creates a certReloader and loads the certificate, failing if it cannot be loaded.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("client certificate requires both a certificate and a key file")
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.certificate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.certificate()
+}
+
+// certificate returns the current certificate, reloading it if a file was modified. If the modified files
+// cannot be loaded, for example while only one of them has been replaced, the previous certificate is kept.
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := modTimes(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	if r.cert != nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			log.Printf("failed to reload client certificate, keeping the previous one: %v", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	if r.cert != nil {
+		log.Printf("Reloaded client certificate from %s", r.certFile)
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+
+	return r.cert, nil
+}
+
+// modTimes returns the modification times of the certificate and the key file.
+func modTimes(certFile, keyFile string) (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
@@ -0,0 +1,227 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues client certificates for the mutual TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// writeClientCert issues a client certificate with the given common name and writes it and its key to dir.
+func (ca *testCA) writeClientCert(t *testing.T, dir, commonName string, modTime time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return certFile, keyFile
+}
+
+// newMTLSServer starts a TLS server requiring a client certificate issued by ca. It answers with the
+// common name of the client certificate and closes every connection, so each request does a new handshake.
+func newMTLSServer(t *testing.T, ca *testCA, maxVersion uint16) (*httptest.Server, string) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MaxVersion: maxVersion,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "server-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, caFile
+}
+
+// get sends a GET request and returns the response body.
+func get(client *Client, url string) (string, error) {
+	resp, err := client.Do(context.Background(), http.MethodGet, url, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestNew_ClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server, caFile := newMTLSServer(t, ca, 0)
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	certFile, keyFile := ca.writeClientCert(t, dir, "client-1", modTime)
+
+	withoutCert, err := New(Config{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(withoutCert, server.URL); err == nil {
+		t.Errorf("Do() without client certificate error = nil, want a handshake error")
+	}
+
+	client, err := New(Config{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := get(client, server.URL); err != nil || got != "client-1" {
+		t.Fatalf("Do() = %q, %v, want client-1", got, err)
+	}
+
+	// A renewed certificate is used for the next handshake.
+	ca.writeClientCert(t, dir, "client-2", modTime.Add(time.Minute))
+	if got, err := get(client, server.URL); err != nil || got != "client-2" {
+		t.Errorf("Do() after renewal = %q, %v, want client-2", got, err)
+	}
+
+	// A broken renewal keeps the previous certificate.
+	if err := os.WriteFile(keyFile, []byte("partially written"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := get(client, server.URL); err != nil || got != "client-2" {
+		t.Errorf("Do() after broken renewal = %q, %v, want client-2", got, err)
+	}
+}
+
+func TestNew_ClientCertificateErrors(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.writeClientCert(t, t.TempDir(), "client-1", time.Now())
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "certificate without key", cfg: Config{CertFile: certFile}},
+		{name: "missing key file", cfg: Config{CertFile: certFile, KeyFile: filepath.Join(t.TempDir(), "missing.key")}},
+		{name: "key and certificate swapped", cfg: Config{CertFile: keyFile, KeyFile: certFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Errorf("New() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNew_MinTLSVersion(t *testing.T) {
+	ca := newTestCA(t)
+	server, caFile := newMTLSServer(t, ca, tls.VersionTLS12)
+	certFile, keyFile := ca.writeClientCert(t, t.TempDir(), "client-1", time.Now())
+
+	client, err := New(Config{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinTLSVersion: tls.VersionTLS13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(client, server.URL); err == nil {
+		t.Errorf("Do() against a TLS 1.2 server with minimum TLS 1.3 error = nil, want a handshake error")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{version: "1.2", want: tls.VersionTLS12},
+		{version: "TLS1.3", want: tls.VersionTLS13},
+		{version: "1.4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseTLSVersion(tt.version)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseTLSVersion() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
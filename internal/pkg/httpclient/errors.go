@@ -0,0 +1,205 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RequestIDHeader is the header carrying the server-side request ID.
+	RequestIDHeader = "X-Request-Id"
+	// RetryAfterHeader is the header carrying the delay a client should wait before retrying.
+	RetryAfterHeader = "Retry-After"
+
+	// maxErrorBodySize limits how much of an error response body is read.
+	maxErrorBodySize = 64 * 1024
+	// maxErrorMessageLength limits the length of a message taken from a non-JSON error body.
+	maxErrorMessageLength = 512
+)
+
+// Rate limit headers carrying the time until the limit resets, checked after RetryAfterHeader.
+var rateLimitResetHeaders = []string{"RateLimit-Reset", "X-RateLimit-Reset"}
+
+// unixTimeThreshold separates a rate limit reset given as delay in seconds from one given as Unix time.
+const unixTimeThreshold = 1_000_000_000
+
+// OAuth error codes signaling that the client credentials are not accepted.
+var badCredentialCodes = map[string]bool{
+	"invalid_client":      true,
+	"unauthorized_client": true,
+	"invalid_grant":       true,
+}
+
+// APIError is returned by Client.Do for a response with a non-2xx status.
+// Use errors.As to inspect it.
+type APIError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Code is the machine-readable error code of the response body, such as "invalid_client".
+	Code string
+	// Message is the human-readable description of the error.
+	Message string
+	// RequestID is the server-side ID of the failed request, if the server returned one.
+	RequestID string
+	// ClientRequestID is the ID sent with the failed request in the ClientRequestIDHeader.
+	ClientRequestID string
+	// Endpoint is the method, host and path of the request. The query is omitted, since it may carry signatures.
+	Endpoint string
+	// RetryAfter is the delay the server asked for before retrying a rate limited or unavailable request.
+	RetryAfter time.Duration
+}
+
+// errorResponse lists the fields of common JSON error bodies.
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Message          string `json:"message"`
+	RequestID        string `json:"request_id"`
+}
+
+// StatusError builds an APIError from the status and headers of a non-2xx response without reading its body, so
+// the response can still be handed on.
+func StatusError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(RequestIDHeader),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		apiErr.RetryAfter = parseRetryAfter(resp.Header, time.Now())
+	}
+	if resp.Request != nil {
+		apiErr.Endpoint = resp.Request.Method + " " + requestEndpoint(resp.Request)
+	}
+
+	return apiErr
+}
+
+// newAPIError builds an APIError from a non-2xx response, consuming its body.
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := StatusError(resp)
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		apiErr.Message = truncateMessage(strings.TrimSpace(string(body)))
+		return apiErr
+	}
+
+	apiErr.Code = errResp.Error
+	apiErr.Message = errResp.ErrorDescription
+	if apiErr.Message == "" {
+		apiErr.Message = errResp.Message
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = errResp.RequestID
+	}
+
+	return apiErr
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "unexpected HTTP status: %d", e.StatusCode)
+	switch {
+	case e.Code != "" && e.Message != "":
+		fmt.Fprintf(&sb, " (%s: %s)", e.Code, e.Message)
+	case e.Code != "":
+		fmt.Fprintf(&sb, " (%s)", e.Code)
+	case e.Message != "":
+		fmt.Fprintf(&sb, " (%s)", e.Message)
+	}
+	if e.Endpoint != "" {
+		fmt.Fprintf(&sb, " from %s", e.Endpoint)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&sb, ", request id %s", e.RequestID)
+	}
+	if e.ClientRequestID != "" {
+		fmt.Fprintf(&sb, ", client request id %s", e.ClientRequestID)
+	}
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&sb, ", retry after %s", e.RetryAfter)
+	}
+
+	return sb.String()
+}
+
+// IsUnauthorized reports whether the request was rejected for a missing, expired or invalid token.
+func (e *APIError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// IsBadCredentials reports whether the client credentials were rejected.
+func (e *APIError) IsBadCredentials() bool {
+	return badCredentialCodes[e.Code]
+}
+
+// IsAccessRevoked reports whether the client is authenticated but no longer allowed to access the resource.
+func (e *APIError) IsAccessRevoked() bool {
+	return e.StatusCode == http.StatusForbidden || e.Code == "access_denied"
+}
+
+// IsRateLimited reports whether the server asked the client to slow down.
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServerFault reports whether the server failed to process a valid request.
+func (e *APIError) IsServerFault() bool {
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// IsPermanent reports whether retrying the same request cannot succeed, which is the case for every
+// client error except timeouts and rate limiting.
+func (e *APIError) IsPermanent() bool {
+	if e.IsBadCredentials() {
+		return true
+	}
+	if e.StatusCode == http.StatusRequestTimeout || e.IsRateLimited() {
+		return false
+	}
+
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError
+}
+
+// parseRetryAfter returns the delay requested by the Retry-After header, given in seconds or as HTTP date,
+// or by a rate limit reset header, given in seconds or as Unix time. It returns 0 if none is set or valid.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if value := strings.TrimSpace(header.Get(RetryAfterHeader)); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return max(time.Duration(seconds)*time.Second, 0)
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(now), 0)
+		}
+	}
+
+	for _, name := range rateLimitResetHeaders {
+		seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get(name)), 10, 64)
+		if err != nil || seconds <= 0 {
+			continue
+		}
+		if seconds >= unixTimeThreshold {
+			return max(time.Unix(seconds, 0).Sub(now), 0)
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 0
+}
+
+// truncateMessage shortens a message taken from a non-JSON body, such as an HTML error page.
+func truncateMessage(message string) string {
+	if len(message) <= maxErrorMessageLength {
+		return message
+	}
+
+	return message[:maxErrorMessageLength] + "..."
+}
@@ -0,0 +1,137 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClient_Do_APIError(t *testing.T) {
+	const url = "https://svc.cipherowl.ai/oauth/token"
+
+	tests := []struct {
+		name          string
+		fault         Fault
+		want          APIError
+		wantPermanent bool
+		check         func(e *APIError) bool
+	}{
+		{
+			name: "bad credentials",
+			fault: RespondWith(http.StatusUnauthorized, http.Header{RequestIDHeader: []string{"req-1"}},
+				`{"error": "invalid_client", "error_description": "Unauthorized"}`),
+			want: APIError{
+				StatusCode: http.StatusUnauthorized,
+				Code:       "invalid_client",
+				Message:    "Unauthorized",
+				RequestID:  "req-1",
+				Endpoint:   "POST svc.cipherowl.ai/oauth/token",
+			},
+			wantPermanent: true,
+			check:         (*APIError).IsBadCredentials,
+		},
+		{
+			name:          "revoked access",
+			fault:         RespondWith(http.StatusForbidden, nil, `{"error": "access_denied", "message": "client disabled", "request_id": "req-2"}`),
+			want:          APIError{StatusCode: http.StatusForbidden, Code: "access_denied", Message: "client disabled", RequestID: "req-2", Endpoint: "POST svc.cipherowl.ai/oauth/token"},
+			wantPermanent: true,
+			check:         (*APIError).IsAccessRevoked,
+		},
+		{
+			name:          "rate limited",
+			fault:         RespondWith(http.StatusTooManyRequests, http.Header{RetryAfterHeader: []string{"30"}}, `{"error": "too_many_requests"}`),
+			want:          APIError{StatusCode: http.StatusTooManyRequests, Code: "too_many_requests", Endpoint: "POST svc.cipherowl.ai/oauth/token", RetryAfter: 30 * time.Second},
+			wantPermanent: false,
+			check:         (*APIError).IsRateLimited,
+		},
+		{
+			name:          "server fault with HTML body",
+			fault:         RespondWith(http.StatusBadGateway, nil, "<html>bad gateway</html>"),
+			want:          APIError{StatusCode: http.StatusBadGateway, Message: "<html>bad gateway</html>", Endpoint: "POST svc.cipherowl.ai/oauth/token"},
+			wantPermanent: false,
+			check:         (*APIError).IsServerFault,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fault answers instead of the server, no request leaves the process.
+			client, err := New(Config{Middlewares: []Middleware{FaultInjection(nil, tt.fault)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(context.Background(), http.MethodPost, url, nil, nil)
+			if resp != nil {
+				t.Errorf("Do() returned a response for a failed request")
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Do() error = %v, want an *APIError", err)
+			}
+			if apiErr.ClientRequestID == "" {
+				t.Errorf("Do() error has no client request id")
+			}
+			apiErr.ClientRequestID = ""
+			if *apiErr != tt.want {
+				t.Errorf("Do() error = %+v, want %+v", *apiErr, tt.want)
+			}
+			if apiErr.IsPermanent() != tt.wantPermanent {
+				t.Errorf("IsPermanent() = %v, want %v", apiErr.IsPermanent(), tt.wantPermanent)
+			}
+			if !tt.check(apiErr) {
+				t.Errorf("classification of %v does not match", apiErr)
+			}
+		})
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{
+			name:   "no header",
+			header: http.Header{},
+			want:   0,
+		},
+		{
+			name:   "retry after seconds",
+			header: http.Header{RetryAfterHeader: []string{"120"}},
+			want:   2 * time.Minute,
+		},
+		{
+			name:   "retry after HTTP date",
+			header: http.Header{RetryAfterHeader: []string{now.Add(90 * time.Second).Format(http.TimeFormat)}},
+			want:   90 * time.Second,
+		},
+		{
+			name:   "retry after date in the past",
+			header: http.Header{RetryAfterHeader: []string{now.Add(-time.Minute).Format(http.TimeFormat)}},
+			want:   0,
+		},
+		{
+			name:   "invalid retry after falls back to rate limit reset",
+			header: http.Header{RetryAfterHeader: []string{"soon"}, "X-Ratelimit-Reset": []string{"15"}},
+			want:   15 * time.Second,
+		},
+		{
+			name:   "rate limit reset as Unix time",
+			header: http.Header{"Ratelimit-Reset": []string{"1731585660"}},
+			want:   time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,52 +2,93 @@ package httpclient
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
 	"time"
 )
 
 const (
 	defaultRequestTimeout = 60 * time.Second // Define a reasonable HTTP request timeout
 
-	ContentTypeHeader   = "Content-Type"
-	AuthorizationHeader = "Authorization"
-	ContentTypeJSON     = "application/json"
+	ContentTypeHeader    = "Content-Type"
+	AuthorizationHeader  = "Authorization"
+	IdempotencyKeyHeader = "Idempotency-Key"
+	ContentTypeJSON      = "application/json"
+
+	// ClientRequestIDHeader is the header carrying the ID generated for every outgoing request.
+	ClientRequestIDHeader = "X-Client-Request-Id"
 )
 
 // Client is a wrapper around http.Client to enforce best practices, like timeout and context usage.
 type Client struct {
-	httpClient *http.Client
+	httpClient      *http.Client
+	logger          *log.Logger
+	bodyIdleTimeout time.Duration
+	debug           bool
+	timings         TimingsRecorder
 }
 
+// sharedClient is the client returned by DefaultClient, sharing its connection pool between all callers.
+var sharedClient = sync.OnceValue(func() *Client {
+	client, err := New(DefaultConfig())
+	if err != nil {
+		// The default configuration refers to no files, building its transport cannot fail.
+		panic(err)
+	}
+	return client
+})
+
 // NewClient creates a new instance of Client with a default timeout.
 func NewClient(timeout time.Duration) *Client {
 	return &Client{
 		httpClient: &http.Client{
 			Timeout: timeout, // Enforce a global timeout for all requests
 		},
+		logger: log.Default(),
 	}
 }
 
-// DefaultClient creates a new instance of Client with a default request timeout.
+// SetLogger sets the logger every request is logged to, nil disables request logging.
+func (c *Client) SetLogger(logger *log.Logger) {
+	c.logger = logger
+}
+
+// CloseIdleConnections closes the pooled keep-alive connections, such as those of a client that was replaced.
+// Requests in flight are not affected.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// DefaultClient returns the client shared by every caller without a custom configuration, so connections are
+// pooled across calls. It must not be modified.
 func DefaultClient() *Client {
-	return NewClient(defaultRequestTimeout)
+	return sharedClient()
 }
 
 // Do send an HTTP request and returns an HTTP response, handling context-related cancellation or deadline exceeded errors.
-// It automatically handles requests with a given `context.Context`.
+// It automatically handles requests with a given `context.Context`. A non-2xx response is returned as *APIError.
+// Every request is sent with a generated ID and logged once its response body is closed. The phases of the
+// request are traced and reported to the timings recorder, and logged in debug mode.
 func (c *Client) Do(ctx context.Context, method, url string, body io.Reader, header map[string]string) (*http.Response, error) {
-	// Create an HTTP request with the provided context
+	// Create an HTTP request with the provided context, canceled once the response body is closed or stalls
+	ctx, cancel := context.WithCancelCause(ctx)
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
+		cancel(nil)
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	for k, v := range header {
 		req.Header.Set(k, v)
 	}
+	requestID := newRequestID()
+	req.Header.Set(ClientRequestIDHeader, requestID)
 
 	// Set default Content-Type header if not provided
 	if body != nil && req.Header.Get(ContentTypeHeader) == "" {
@@ -55,8 +96,15 @@ func (c *Client) Do(ctx context.Context, method, url string, body io.Reader, hea
 	}
 
 	// Send the request
+	trace := newRequestTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		cancel(nil)
+		c.observeTimings(req, trace)
+		c.logf("http: %s %s failed after %s, client request id %s: %v",
+			method, requestEndpoint(req), time.Since(start).Round(time.Millisecond), requestID, err)
 		// Handle specific context-related errors
 		if errors.Is(err, context.Canceled) {
 			return nil, fmt.Errorf("request canceled due to context cancellation: %w", err)
@@ -67,11 +115,157 @@ func (c *Client) Do(ctx context.Context, method, url string, body io.Reader, hea
 		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 
-	// Check for unexpected response statuses (example: return an error for 5xx responses, etc.)
+	resp.Body = &loggedBody{
+		ReadCloser: newIdleTimeoutBody(ctx, resp.Body, c.bodyIdleTimeout, cancel),
+		log: func(n int64) {
+			c.observeTimings(req, trace)
+			c.logf("http: %s %s %d in %s, %d bytes, client request id %s%s",
+				method, requestEndpoint(req), resp.StatusCode, time.Since(start).Round(time.Millisecond), n, requestID,
+				serverRequestID(resp))
+		},
+	}
+
+	// Turn unexpected response statuses into an APIError carrying the explanation of the server
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer resp.Body.Close()
-		return resp, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+		apiErr := newAPIError(resp)
+		apiErr.ClientRequestID = requestID
+		return nil, apiErr
 	}
 
 	return resp, nil
 }
+
+// observeTimings reports the timings of a finished request and logs them in debug mode.
+func (c *Client) observeTimings(req *http.Request, trace *requestTrace) {
+	if !c.debug && c.timings == nil {
+		return
+	}
+
+	timings := trace.timings(time.Now())
+	if c.debug {
+		c.logf("http: timings %s %s: %s", req.Method, requestEndpoint(req), timings)
+	}
+	if c.timings != nil {
+		c.timings.ObserveTimings(req.Method, endpointName(req), timings)
+	}
+}
+
+// logf logs a request if logging is enabled.
+func (c *Client) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
+// loggedBody counts the bytes read from a response body and logs the request once the body is closed.
+type loggedBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	log  func(n int64)
+}
+
+// Read implements io.Reader.
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.log(b.n) })
+	return err
+}
+
+// ErrBodyIdleTimeout is returned when a response body delivers no data for the configured idle timeout.
+var ErrBodyIdleTimeout = errors.New("response body idle timeout exceeded")
+
+// idleTimeoutBody cancels the request if the response body delivers no data for the idle timeout, and once the
+// body is closed.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleTimeoutBody wraps a response body, a zero timeout only cancels the request on close.
+func newIdleTimeoutBody(ctx context.Context, body io.ReadCloser, timeout time.Duration, cancel context.CancelCauseFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, ctx: ctx, cancel: cancel, timeout: timeout}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() { cancel(ErrBodyIdleTimeout) })
+	}
+
+	return b
+}
+
+// Read implements io.Reader.
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.Is(context.Cause(b.ctx), ErrBodyIdleTimeout) {
+		return n, fmt.Errorf("failed to read response body: %w", ErrBodyIdleTimeout)
+	}
+	if b.timer != nil && n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+
+	return err
+}
+
+// endpointKey is the context key of the endpoint name set by WithEndpoint.
+type endpointKey struct{}
+
+// WithEndpoint names the logical endpoint of the requests sent with ctx, such as the token or upload endpoint of
+// an API. Circuit breakers are kept per endpoint name, so requests to URLs differing in every call, like presigned
+// download URLs, share one breaker. Requests without a name are grouped by host.
+func WithEndpoint(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, name)
+}
+
+// endpointName returns the endpoint name of a request set with WithEndpoint, or its host if there is none.
+func endpointName(req *http.Request) string {
+	if name, ok := req.Context().Value(endpointKey{}).(string); ok && name != "" {
+		return name
+	}
+
+	return req.URL.Host
+}
+
+// requestEndpoint returns the host and path of a request. The query is omitted, since it may carry signatures.
+func requestEndpoint(req *http.Request) string {
+	return req.URL.Host + req.URL.Path
+}
+
+// serverRequestID formats the request ID returned by the server for a log line, if there is one.
+func serverRequestID(resp *http.Response) string {
+	if id := resp.Header.Get(RequestIDHeader); id != "" {
+		return ", server request id " + id
+	}
+
+	return ""
+}
+
+// newRequestID returns a random UUID (version 4) identifying an outgoing request.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,119 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Do_RequestLogging(t *testing.T) {
+	var receivedID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedID = r.Header.Get(ClientRequestIDHeader)
+		w.Header().Set(RequestIDHeader, "server-req-1")
+		io.WriteString(w, "bloom_filter_data")
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	client, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetLogger(log.New(&logs, "", 0))
+
+	resp, err := client.Do(context.Background(), http.MethodGet, server.URL+"/files/bloom_filter.gob?X-Amz-Signature=secret", nil, nil)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(receivedID) {
+		t.Errorf("server received client request id %q, want a UUID", receivedID)
+	}
+
+	line := logs.String()
+	for _, want := range []string{"GET", "/files/bloom_filter.gob", " 200 ", "17 bytes", receivedID, "server request id server-req-1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q does not contain %q", line, want)
+		}
+	}
+	if strings.Contains(line, "secret") {
+		t.Errorf("log line %q leaks the query string", line)
+	}
+}
+
+func TestClient_Do_Timeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-header":
+			time.Sleep(200 * time.Millisecond)
+		case "/stalled-body":
+			io.WriteString(w, "first chunk")
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+		case "/slow-body":
+			// A slow but progressing body outlasts the idle timeout in total.
+			for range 5 {
+				io.WriteString(w, "chunk")
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Config{ResponseHeaderTimeout: 100 * time.Millisecond, BodyIdleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		want            string
+		wantErr         bool
+		wantIdleTimeout bool
+	}{
+		{name: "response header timeout", path: "/slow-header", wantErr: true},
+		{name: "stalled body", path: "/stalled-body", wantErr: true, wantIdleTimeout: true},
+		{name: "slow but progressing body", path: "/slow-body", want: "chunkchunkchunkchunkchunk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Do(context.Background(), http.MethodGet, server.URL+tt.path, nil, nil)
+			if err == nil {
+				var body []byte
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err == nil && string(body) != tt.want {
+					t.Errorf("body = %q, want %q", body, tt.want)
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIdleTimeout && !errors.Is(err, ErrBodyIdleTimeout) {
+				t.Errorf("Do() error = %v, want %v", err, ErrBodyIdleTimeout)
+			}
+		})
+	}
+}
+
+func TestDefaultClient_Shared(t *testing.T) {
+	if DefaultClient() != DefaultClient() {
+		t.Errorf("DefaultClient() returned different clients, want one shared client")
+	}
+}
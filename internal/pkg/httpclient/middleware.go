@@ -0,0 +1,191 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+)
+
+// Middleware wraps a RoundTripper to add cross-cutting behavior to every request of a Client.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps rt with the middlewares. The first middleware is the outermost, it sees a request first.
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+
+	return rt
+}
+
+// Logging logs every round trip, including the attempts repeated by Retry, with its status and duration.
+func Logging(logger *log.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			duration := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logger.Printf("http: round trip %s %s failed after %s: %v", req.Method, requestEndpoint(req), duration, err)
+				return nil, err
+			}
+
+			logger.Printf("http: round trip %s %s %d in %s", req.Method, requestEndpoint(req), resp.StatusCode, duration)
+			return resp, nil
+		})
+	}
+}
+
+// MetricsRecorder receives the outcome of every round trip.
+type MetricsRecorder interface {
+	// ObserveRoundTrip records a round trip to host. The status is 0 if no response was received.
+	ObserveRoundTrip(method, host string, status int, duration time.Duration, err error)
+}
+
+// Metrics reports every round trip to the recorder.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			recorder.ObserveRoundTrip(req.Method, req.URL.Host, status, time.Since(start), err)
+
+			return resp, err
+		})
+	}
+}
+
+// BearerAuth sets the Authorization header of requests without one to a token of the source. Requests to
+// hosts other than the given ones are left alone, so tokens do not leak to presigned download hosts.
+func BearerAuth(token func(ctx context.Context) (string, error), hosts ...string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(AuthorizationHeader) != "" || !matchHost(req.URL.Host, hosts) {
+				return next.RoundTrip(req)
+			}
+
+			t, err := token(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get access token: %w", err)
+			}
+
+			// A RoundTripper must not modify the request it was given.
+			req = req.Clone(req.Context())
+			req.Header.Set(AuthorizationHeader, "Bearer "+t)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// CircuitBreaker fails requests fast while the breaker of their endpoint, named with WithEndpoint or else the host
+// of the URL, is open.
+// Transport errors and 429 or 5xx responses count as failures, requests canceled by the caller do not count.
+func CircuitBreaker(breakers *circuitbreaker.Set) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			breaker := breakers.Get(endpointName(req))
+			if err := breaker.Allow(); err != nil {
+				return nil, err
+			}
+
+			resp, err := next.RoundTrip(req)
+			switch {
+			case err != nil && req.Context().Err() != nil:
+				breaker.Skip()
+			case err != nil:
+				breaker.Done(false)
+			default:
+				breaker.Done(resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500)
+			}
+
+			return resp, err
+		})
+	}
+}
+
+// Fault produces the outcome of a request instead of sending it.
+type Fault func(req *http.Request) (*http.Response, error)
+
+// FaultInjection answers the requests selected by match with the fault instead of sending them. A nil match
+// selects every request. It is meant for tests and for exercising failure handling against real servers.
+func FaultInjection(match func(*http.Request) bool, fault Fault) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if match != nil && !match(req) {
+				return next.RoundTrip(req)
+			}
+
+			return fault(req)
+		})
+	}
+}
+
+// Randomly selects the given fraction of requests, between 0 and 1, for FaultInjection.
+func Randomly(rate float64) func(*http.Request) bool {
+	return func(*http.Request) bool {
+		return mathrand.Float64() < rate
+	}
+}
+
+// RespondWith is a Fault answering with the given status, header and body.
+func RespondWith(status int, header http.Header, body string) Fault {
+	return func(req *http.Request) (*http.Response, error) {
+		if header == nil {
+			header = http.Header{}
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+// FailWith is a Fault failing the round trip with err, like a network error.
+func FailWith(err error) Fault {
+	return func(*http.Request) (*http.Response, error) {
+		return nil, err
+	}
+}
+
+// matchHost reports whether host is one of hosts, or hosts is empty.
+func matchHost(host string, hosts []string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+
+	return false
+}
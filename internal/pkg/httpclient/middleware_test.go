@@ -0,0 +1,192 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+)
+
+// recordingTransport answers with the queued statuses in order and records the received requests and bodies.
+type recordingTransport struct {
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, req)
+	body := ""
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+	rt.bodies = append(rt.bodies, body)
+
+	status := http.StatusOK
+	if len(rt.statuses) > 0 {
+		status, rt.statuses = rt.statuses[0], rt.statuses[1:]
+	}
+
+	return RespondWith(status, nil, "")(req)
+}
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	rt := Chain(&recordingTransport{}, tag("outer"), tag("inner"))
+	req, _ := http.NewRequest(http.MethodGet, "https://svc.cipherowl.ai/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("middlewares ran in order %v, want outer,inner", order)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	transport := &recordingTransport{}
+	rt := Chain(transport, BearerAuth(func(context.Context) (string, error) { return "test_access_token", nil }, "svc.cipherowl.ai"))
+
+	for _, url := range []string{"https://svc.cipherowl.ai/api/bloom-filter/file/1", "https://bucket.s3.amazonaws.com/bloom_filter.gob"} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Header.Get(AuthorizationHeader) != "" {
+			t.Errorf("BearerAuth modified the original request")
+		}
+	}
+
+	if got := transport.requests[0].Header.Get(AuthorizationHeader); got != "Bearer test_access_token" {
+		t.Errorf("API request Authorization = %q, want the bearer token", got)
+	}
+	if got := transport.requests[1].Header.Get(AuthorizationHeader); got != "" {
+		t.Errorf("download request Authorization = %q, want none", got)
+	}
+
+	failing := Chain(transport, BearerAuth(func(context.Context) (string, error) { return "", errors.New("invalid_client") }))
+	req, _ := http.NewRequest(http.MethodGet, "https://svc.cipherowl.ai/", nil)
+	if _, err := failing.RoundTrip(req); err == nil {
+		t.Errorf("RoundTrip() error = nil, want the token error")
+	}
+}
+
+// observation is a round trip reported to testRecorder.
+type observation struct {
+	host   string
+	status int
+	err    error
+}
+
+type testRecorder []observation
+
+func (r *testRecorder) ObserveRoundTrip(method, host string, status int, duration time.Duration, err error) {
+	*r = append(*r, observation{host: host, status: status, err: err})
+}
+
+func TestMetricsAndLogging(t *testing.T) {
+	var recorder testRecorder
+	var logs bytes.Buffer
+	netErr := errors.New("connection reset by peer")
+
+	client, err := New(Config{Middlewares: []Middleware{
+		Metrics(&recorder),
+		Logging(log.New(&logs, "", 0)),
+		FaultInjection(func(req *http.Request) bool { return req.URL.Path == "/reset" }, FailWith(netErr)),
+		FaultInjection(nil, RespondWith(http.StatusOK, nil, "ok")),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(context.Background(), http.MethodGet, "https://svc.cipherowl.ai/ok", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, err := client.Do(context.Background(), http.MethodGet, "https://svc.cipherowl.ai/reset", nil, nil); !errors.Is(err, netErr) {
+		t.Errorf("Do() error = %v, want the injected error", err)
+	}
+
+	if len(recorder) != 2 || recorder[0].status != http.StatusOK || recorder[1].status != 0 || !errors.Is(recorder[1].err, netErr) {
+		t.Errorf("recorded %+v, want a 200 and a failed round trip", recorder)
+	}
+	if lines := strings.Count(logs.String(), "http: round trip"); lines != 2 {
+		t.Errorf("logged %d round trips, want 2:\n%s", lines, logs.String())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	transport := &recordingTransport{statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}}
+	breakers := circuitbreaker.NewSet(circuitbreaker.Config{FailureThreshold: 2, Cooldown: time.Hour}, nil)
+	rt := Chain(transport, CircuitBreaker(breakers))
+
+	roundTrip := func(endpoint, url string) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(WithEndpoint(context.Background(), endpoint), http.MethodGet, url, nil)
+		return rt.RoundTrip(req)
+	}
+
+	// Presigned URLs differ in every request, they share the breaker of their endpoint.
+	for _, url := range []string{"https://bucket.s3.amazonaws.com/filters/1?sig=a", "https://bucket.s3.amazonaws.com/filters/2?sig=b"} {
+		if _, err := roundTrip("download", url); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The breaker of the failing endpoint is open, requests fail without being sent.
+	if _, err := roundTrip("download", "https://bucket.s3.amazonaws.com/filters/3?sig=c"); !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Errorf("RoundTrip() error = %v, want ErrOpen", err)
+	}
+	if len(transport.requests) != 2 {
+		t.Errorf("sent %d requests, want 2", len(transport.requests))
+	}
+
+	// Other endpoints have their own breaker.
+	if resp, err := roundTrip("token", "https://svc.cipherowl.ai/oauth/token"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() to another endpoint = %v, %v, want 200", resp, err)
+	}
+}
+
+func Test_endpointName(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "named endpoint",
+			ctx:  WithEndpoint(context.Background(), "upload"),
+			want: "upload",
+		},
+		{
+			name: "host without name",
+			ctx:  context.Background(),
+			want: "bucket.s3.amazonaws.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, "https://bucket.s3.amazonaws.com/filters/1?sig=a", nil)
+			if got := endpointName(req); got != tt.want {
+				t.Errorf("endpointName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timings is the duration of each phase of a request. Phases skipped, such as DNS, connect and TLS on a reused
+// connection, are zero.
+type Timings struct {
+	// DNS is the duration of the host name lookup.
+	DNS time.Duration
+	// Connect is the duration of establishing the TCP connection.
+	Connect time.Duration
+	// TLS is the duration of the TLS handshake.
+	TLS time.Duration
+	// TimeToFirstByte is the time from the request being written to the first response byte.
+	TimeToFirstByte time.Duration
+	// Transfer is the time from the first response byte until the body was read and closed.
+	Transfer time.Duration
+	// Total is the duration of the whole request.
+	Total time.Duration
+	// ReusedConn reports whether a pooled keep-alive connection was used.
+	ReusedConn bool
+}
+
+// String formats the timings for a log line.
+func (t Timings) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dns %s, connect %s, tls %s, ttfb %s, transfer %s, total %s",
+		t.DNS.Round(time.Millisecond), t.Connect.Round(time.Millisecond), t.TLS.Round(time.Millisecond),
+		t.TimeToFirstByte.Round(time.Millisecond), t.Transfer.Round(time.Millisecond), t.Total.Round(time.Millisecond))
+	if t.ReusedConn {
+		b.WriteString(", reused connection")
+	}
+
+	return b.String()
+}
+
+// TimingsRecorder receives the timings of every request sent by Client.Do.
+type TimingsRecorder interface {
+	// ObserveTimings records the timings of a request to endpoint, the name set with WithEndpoint or else the host
+	// of its URL.
+	ObserveTimings(method, endpoint string, timings Timings)
+}
+
+// requestTrace collects the phase timestamps of a request. The httptrace hooks may be called from the
+// goroutines of the transport, so the timestamps are guarded by a mutex. When the retrypolicy middleware repeats
+// the round trip, the phases of the last attempt are reported, the total includes all attempts and their delays.
+type requestTrace struct {
+	start time.Time
+
+	mu                       sync.Mutex
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	wroteRequest, firstByte  time.Time
+	reused                   bool
+}
+
+// newRequestTrace starts tracing a request.
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now()}
+}
+
+// clientTrace returns the httptrace hooks recording the phases.
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		// A connection is requested at the start of every round trip, the phases of a previous attempt and the
+		// backoff after it are discarded.
+		GetConn:  func(string) { t.reset() },
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		// With several addresses the connection attempts may race, the first start and last success count.
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.set(&t.connectEnd)
+			}
+		},
+		TLSHandshakeStart: func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}
+}
+
+// reset discards the phase timestamps recorded so far.
+func (t *requestTrace) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+	t.connectStart, t.connectEnd = time.Time{}, time.Time{}
+	t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+	t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+	t.reused = false
+}
+
+// set records the current time in field.
+func (t *requestTrace) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*field = time.Now()
+}
+
+// timings returns the phase durations of a request that ended at end.
+func (t *requestTrace) timings(end time.Time) Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := Timings{
+		DNS:             between(t.dnsStart, t.dnsDone),
+		Connect:         between(t.connectStart, t.connectEnd),
+		TLS:             between(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: between(t.wroteRequest, t.firstByte),
+		Total:           end.Sub(t.start),
+		ReusedConn:      t.reused,
+	}
+	if !t.firstByte.IsZero() {
+		timings.Transfer = end.Sub(t.firstByte)
+	}
+
+	return timings
+}
+
+// between returns the time from start to end, or zero if either was not recorded.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
@@ -0,0 +1,101 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timingsLog records the endpoints and timings reported for every request.
+type timingsLog struct {
+	endpoints []string
+	timings   []Timings
+}
+
+func (l *timingsLog) ObserveTimings(method, endpoint string, timings Timings) {
+	l.endpoints = append(l.endpoints, endpoint)
+	l.timings = append(l.timings, timings)
+}
+
+func TestClient_Do_Timings(t *testing.T) {
+	const firstByteDelay = 50 * time.Millisecond
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(firstByteDelay)
+		w.Header().Set("Content-Length", "17")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "bloom_filter_data")
+	}))
+	defer server.Close()
+
+	var recorded timingsLog
+	var logs bytes.Buffer
+	client, err := New(Config{Debug: true, Timings: &recorded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetLogger(log.New(&logs, "", 0))
+	// Trust the certificate of the test server.
+	client.httpClient.Transport = server.Client().Transport
+
+	for _, ctx := range []context.Context{WithEndpoint(context.Background(), "download"), context.Background()} {
+		resp, err := client.Do(ctx, http.MethodGet, server.URL+"/files/bloom_filter.gob", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if len(recorded.timings) != 2 {
+		t.Fatalf("recorded %d timings, want 2", len(recorded.timings))
+	}
+	// Metrics are kept per endpoint name, the path of presigned URLs would add an endpoint per download.
+	host := strings.TrimPrefix(server.URL, "https://")
+	if got := strings.Join(recorded.endpoints, ","); got != "download,"+host {
+		t.Errorf("recorded endpoints %s, want download,%s", got, host)
+	}
+	first, second := recorded.timings[0], recorded.timings[1]
+	if first.Connect <= 0 || first.TLS <= 0 || first.ReusedConn {
+		t.Errorf("first request timings = %+v, want a new connection with TLS handshake", first)
+	}
+	if first.TimeToFirstByte < firstByteDelay || first.Total < first.TimeToFirstByte {
+		t.Errorf("first request timings = %+v, want a time to first byte of at least %s", first, firstByteDelay)
+	}
+	if !second.ReusedConn || second.Connect != 0 || second.TLS != 0 {
+		t.Errorf("second request timings = %+v, want a reused connection", second)
+	}
+	if lines := strings.Count(logs.String(), "http: timings GET"); lines != 2 {
+		t.Errorf("logged %d timings, want 2:\n%s", lines, logs.String())
+	}
+}
+
+func Test_requestTrace_RetryResetsPhases(t *testing.T) {
+	const backoff = 50 * time.Millisecond
+	trace := newRequestTrace()
+	hooks := trace.clientTrace()
+
+	// The first attempt fails to connect, the second one starts after a backoff.
+	hooks.GetConn("svc.cipherowl.ai:443")
+	hooks.ConnectStart("tcp", "192.0.2.1:443")
+	hooks.ConnectDone("tcp", "192.0.2.1:443", errors.New("connection refused"))
+	time.Sleep(backoff)
+	hooks.GetConn("svc.cipherowl.ai:443")
+	hooks.ConnectStart("tcp", "192.0.2.1:443")
+	hooks.ConnectDone("tcp", "192.0.2.1:443", nil)
+
+	timings := trace.timings(time.Now())
+	if timings.Connect >= backoff {
+		t.Errorf("Connect = %s, want the connect time of the last attempt without the backoff", timings.Connect)
+	}
+	if timings.Total < backoff {
+		t.Errorf("Total = %s, want at least %s", timings.Total, backoff)
+	}
+}
@@ -0,0 +1,255 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default connection settings of the shared client, tuned for a few hosts contacted repeatedly.
+const (
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+	defaultBodyIdleTimeout       = 60 * time.Second
+	defaultMaxIdleConns          = 100
+	defaultMaxIdleConnsPerHost   = 10
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultKeepAlive             = 30 * time.Second
+)
+
+// Config configures the timeouts, the connection pool and the transport of a Client.
+type Config struct {
+	// Timeout limits the duration of a request including reading the response body, zero disables the limit.
+	// Prefer the more specific timeouts below, which do not cut off large downloads.
+	Timeout time.Duration
+	// DialTimeout limits establishing a TCP connection.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for the response headers once the request is sent.
+	ResponseHeaderTimeout time.Duration
+	// BodyIdleTimeout aborts a response body that delivers no data for this long, so a stalled download
+	// fails without limiting the duration of a slow but progressing one.
+	BodyIdleTimeout time.Duration
+	// MaxIdleConns and MaxIdleConnsPerHost limit the idle keep-alive connections kept in the pool.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle keep-alive connection is kept.
+	IdleConnTimeout time.Duration
+
+	// ProxyURL is the proxy all requests are sent through. The HTTPS_PROXY and HTTP_PROXY environment variables
+	// are used if it is empty.
+	ProxyURL string
+	// NoProxy lists the hosts contacted directly: host names matching themselves and their subdomains, IP
+	// addresses, CIDR ranges and "*" for all hosts, each optionally with a port.
+	NoProxy []string
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system pool, such as the CA
+	// of a TLS intercepting proxy.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented to servers requesting mutual TLS.
+	// They are reloaded when the files change.
+	CertFile string
+	KeyFile  string
+	// MinTLSVersion is the minimum TLS version, such as tls.VersionTLS13.
+	MinTLSVersion uint16
+
+	// Middlewares wrap the transport, the first one is the outermost.
+	Middlewares []Middleware
+
+	// Debug logs the DNS, connect, TLS, time to first byte and transfer timings of every request.
+	Debug bool
+	// Timings receives the timings of every request, if not nil.
+	Timings TimingsRecorder
+}
+
+// DefaultConfig returns the configuration of the shared client returned by DefaultClient.
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout:           defaultDialTimeout,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+		BodyIdleTimeout:       defaultBodyIdleTimeout,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		MinTLSVersion:         tls.VersionTLS12,
+	}
+}
+
+// New creates a Client with the given configuration. Zero timeouts and pool sizes, except Timeout, take the
+// values of DefaultConfig.
+func New(cfg Config) (*Client, error) {
+	cfg = withDefaults(cfg)
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewClient(cfg.Timeout)
+	client.httpClient.Transport = Chain(transport, cfg.Middlewares...)
+	client.bodyIdleTimeout = cfg.BodyIdleTimeout
+	client.debug = cfg.Debug
+	client.timings = cfg.Timings
+
+	return client, nil
+}
+
+// withDefaults fills the unset settings of cfg with the values of DefaultConfig.
+func withDefaults(cfg Config) Config {
+	defaults := DefaultConfig()
+	setDefault(&cfg.DialTimeout, defaults.DialTimeout)
+	setDefault(&cfg.TLSHandshakeTimeout, defaults.TLSHandshakeTimeout)
+	setDefault(&cfg.ResponseHeaderTimeout, defaults.ResponseHeaderTimeout)
+	setDefault(&cfg.BodyIdleTimeout, defaults.BodyIdleTimeout)
+	setDefault(&cfg.MaxIdleConns, defaults.MaxIdleConns)
+	setDefault(&cfg.MaxIdleConnsPerHost, defaults.MaxIdleConnsPerHost)
+	setDefault(&cfg.IdleConnTimeout, defaults.IdleConnTimeout)
+	setDefault(&cfg.MinTLSVersion, defaults.MinTLSVersion)
+
+	return cfg
+}
+
+// setDefault sets *value to def if it is not positive.
+func setDefault[T time.Duration | int | uint16](value *T, def T) {
+	if *value <= 0 {
+		*value = def
+	}
+}
+
+// newTransport builds an HTTP transport with the timeouts, the pool, the proxy and the certificate authorities
+// of the configuration.
+func newTransport(cfg Config) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.ProxyURL)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if matchNoProxy(req.URL, cfg.NoProxy) {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: cfg.MinTLSVersion,
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" or "1.3".
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// loadCertPool returns the system certificate pool extended by the certificates of a PEM file.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file %s contains no PEM certificates", caFile)
+	}
+
+	return pool, nil
+}
+
+// matchNoProxy reports whether the URL's host matches one of the no-proxy entries.
+func matchNoProxy(u *url.URL, entries []string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+
+		// A CIDR range matches the IP addresses it contains.
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		entryHost = strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+
+	return false
+}
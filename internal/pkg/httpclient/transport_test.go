@@ -0,0 +1,119 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_matchNoProxy(t *testing.T) {
+	noProxy := []string{"localhost", ".internal.example.com", "cipherowl.ai", "10.0.0.0/8", "192.168.1.1", "storage.example.com:8443"}
+
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{name: "exact host", url: "http://localhost:8090/", want: true},
+		{name: "subdomain of leading dot entry", url: "https://api.internal.example.com/", want: true},
+		{name: "subdomain of plain entry", url: "https://svc.cipherowl.ai/oauth/token", want: true},
+		{name: "suffix without dot does not match", url: "https://notcipherowl.ai/", want: false},
+		{name: "IP in CIDR range", url: "http://10.1.2.3/", want: true},
+		{name: "exact IP", url: "http://192.168.1.1/", want: true},
+		{name: "entry with matching port", url: "https://storage.example.com:8443/file", want: true},
+		{name: "entry with other port", url: "https://storage.example.com/file", want: false},
+		{name: "unlisted host", url: "https://s3.amazonaws.com/bucket", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchNoProxy(u, noProxy); got != tt.want {
+				t.Errorf("matchNoProxy(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	if u, _ := url.Parse("https://anything.example.org/"); !matchNoProxy(u, []string{"*"}) {
+		t.Errorf("matchNoProxy() with * = false, want true")
+	}
+}
+
+func TestNew_Proxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the target.
+		proxied = append(proxied, r.URL.String())
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	client, err := New(Config{ProxyURL: proxy.URL, NoProxy: []string{"direct.invalid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(context.Background(), http.MethodGet, "http://svc.cipherowl.invalid/api", nil, nil)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if len(proxied) != 1 || proxied[0] != "http://svc.cipherowl.invalid/api" {
+		t.Errorf("proxy received %v, want the CipherOwl request", proxied)
+	}
+
+	// Hosts on the no-proxy list are contacted directly, which fails for the unresolvable test domain.
+	if _, err := client.Do(context.Background(), http.MethodGet, "http://direct.invalid/", nil, nil); err == nil {
+		t.Errorf("Do() for a no-proxy host error = nil, want a connection error")
+	}
+	if len(proxied) != 1 {
+		t.Errorf("proxy received %v, want only the CipherOwl request", proxied)
+	}
+}
+
+func TestNew_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	// The test server's certificate is not trusted by the system pool.
+	untrusted, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.Do(context.Background(), http.MethodGet, server.URL, nil, nil); err == nil {
+		t.Errorf("Do() without CA file error = nil, want a certificate error")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, err := New(Config{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := trusted.Do(context.Background(), http.MethodGet, server.URL, nil, nil)
+	if err != nil {
+		t.Fatalf("Do() with CA file error = %v", err)
+	}
+	resp.Body.Close()
+
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{CAFile: caFile}); err == nil {
+		t.Errorf("New() with an invalid CA file error = nil, want an error")
+	}
+}
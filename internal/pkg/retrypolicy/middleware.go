@@ -0,0 +1,97 @@
+package retrypolicy
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// Middleware repeats failed round trips with the policy, honoring the delays requested by the server like Do.
+// Only requests that are safe to repeat are retried: idempotent methods and requests with an idempotency key,
+// whose body can be replayed. Transport errors and 429, 502, 503 and 504 responses are failures. The last
+// response or error is returned.
+func Middleware(p Policy) httpclient.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return httpclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !isReplayable(req) {
+				return next.RoundTrip(req)
+			}
+
+			var (
+				resp    *http.Response
+				attempt int
+			)
+			err := p.Do(req.Context(), func(ctx context.Context) error {
+				if resp != nil {
+					discard(resp)
+					resp = nil
+				}
+
+				attemptReq := req
+				if attempt++; attempt > 1 && req.Body != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return Permanent(err)
+					}
+					attemptReq = req.Clone(ctx)
+					attemptReq.Body = body
+				}
+
+				var err error
+				resp, err = next.RoundTrip(attemptReq)
+				if err != nil {
+					return err
+				}
+				if isRetryableStatus(resp.StatusCode) {
+					return httpclient.StatusError(resp)
+				}
+
+				return nil
+			})
+			switch {
+			case req.Context().Err() != nil:
+				if resp != nil {
+					discard(resp)
+				}
+				return nil, req.Context().Err()
+			case resp != nil:
+				// The last response is handed on even if it is a failure, like without the middleware.
+				return resp, nil
+			default:
+				return nil, err
+			}
+		})
+	}
+}
+
+// isRetryableStatus reports whether a response signals a temporary failure of the server or a gateway, or a
+// rate limit.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// discard closes a response that is not handed on, draining a little of its body so the connection can be reused.
+func discard(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, 4096)
+	resp.Body.Close()
+}
+
+// isReplayable reports whether a request may be sent again without side effects.
+func isReplayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get(httpclient.IdempotencyKeyHeader) != ""
+}
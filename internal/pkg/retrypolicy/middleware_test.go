@@ -0,0 +1,146 @@
+package retrypolicy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// queuedTransport answers with the queued responses in order and records the received bodies.
+type queuedTransport struct {
+	responses []httpclient.Fault
+	bodies    []string
+}
+
+func (rt *queuedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+	rt.bodies = append(rt.bodies, body)
+
+	respond := httpclient.RespondWith(http.StatusOK, nil, "")
+	if len(rt.responses) > 0 {
+		respond, rt.responses = rt.responses[0], rt.responses[1:]
+	}
+
+	return respond(req)
+}
+
+// status answers with the given status.
+func status(code int) httpclient.Fault {
+	return httpclient.RespondWith(code, nil, "")
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		header       http.Header
+		responses    []httpclient.Fault
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "idempotent request retried until success",
+			method:       http.MethodGet,
+			responses:    []httpclient.Fault{status(http.StatusServiceUnavailable), status(http.StatusBadGateway), status(http.StatusOK)},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			method:       http.MethodGet,
+			responses:    []httpclient.Fault{status(http.StatusServiceUnavailable), status(http.StatusServiceUnavailable), status(http.StatusServiceUnavailable), status(http.StatusOK)},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "client error not retried",
+			method:       http.MethodGet,
+			responses:    []httpclient.Fault{status(http.StatusBadRequest), status(http.StatusOK)},
+			wantStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+		{
+			name:         "network error retried",
+			method:       http.MethodGet,
+			responses:    []httpclient.Fault{httpclient.FailWith(io.ErrUnexpectedEOF), status(http.StatusOK)},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "post without idempotency key not retried",
+			method:       http.MethodPost,
+			responses:    []httpclient.Fault{status(http.StatusServiceUnavailable), status(http.StatusOK)},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+		{
+			name:         "post with idempotency key retried with the same body",
+			method:       http.MethodPost,
+			header:       http.Header{httpclient.IdempotencyKeyHeader: []string{"test_batch_id"}},
+			responses:    []httpclient.Fault{status(http.StatusGatewayTimeout), status(http.StatusOK)},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &queuedTransport{responses: tt.responses}
+			policy := Policy{Attempts: 3, InitialDelay: time.Millisecond, Logger: log.New(io.Discard, "", 0)}
+			rt := httpclient.Chain(transport, Middleware(policy))
+
+			req, _ := http.NewRequest(tt.method, "https://svc.cipherowl.ai/api/upload/report/v1", bytes.NewReader([]byte("test_report_file")))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if len(transport.bodies) != tt.wantAttempts {
+				t.Errorf("sent %d requests, want %d", len(transport.bodies), tt.wantAttempts)
+			}
+			for i, body := range transport.bodies {
+				if body != "test_report_file" {
+					t.Errorf("attempt %d sent body %q, want the original body", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_RetryAfter(t *testing.T) {
+	const serverDelay = 50 * time.Millisecond
+	transport := &queuedTransport{responses: []httpclient.Fault{
+		httpclient.RespondWith(http.StatusTooManyRequests, http.Header{httpclient.RetryAfterHeader: []string{"120"}}, ""),
+		status(http.StatusOK),
+	}}
+	// The requested delay is capped by MaxServerDelay to keep the test short, it exceeds the backoff by far.
+	policy := Policy{Attempts: 2, InitialDelay: time.Millisecond, MaxServerDelay: serverDelay, Logger: log.New(io.Discard, "", 0)}
+	rt := httpclient.Chain(transport, Middleware(policy))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://svc.cipherowl.ai/api/bloom-filter/file/1", nil)
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < serverDelay {
+		t.Errorf("retried after %s, want at least the server delay of %s", elapsed, serverDelay)
+	}
+}
@@ -0,0 +1,189 @@
+// Package retrypolicy retries operations with exponential backoff and full jitter, honoring the delays
+// requested by rate limited servers.
+package retrypolicy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+// Policy describes how an operation is retried. The zero value runs an operation once.
+type Policy struct {
+	// Name identifies the operation in log messages, "operation" if empty.
+	Name string
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts uint
+	// InitialDelay is the upper bound of the first backoff, it doubles with every attempt up to MaxDelay.
+	// The actual delay is drawn uniformly between zero and the bound (full jitter), so clients failing
+	// at the same time spread their retries.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// MaxElapsed stops retrying once this much time passed since the first attempt, or when the server asks
+	// for a longer delay than is left. Zero disables the limit.
+	MaxElapsed time.Duration
+	// MaxServerDelay caps the delay a rate limited or unavailable server may request with Retry-After.
+	MaxServerDelay time.Duration
+	// Retryable classifies an error as transient, IsTransient if nil.
+	Retryable func(err error) bool
+	// Logger logs retries and the delays requested by servers, log.Default() if nil.
+	Logger *log.Logger
+}
+
+// Do runs op until it succeeds, fails permanently, the attempts or the elapsed time are exhausted, or the
+// context is done. It returns the error of the last attempt.
+func (p Policy) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	start := time.Now()
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	return retry.Do(
+		func() error {
+			return op(ctx)
+		},
+		retry.Context(ctx),
+		retry.Attempts(max(p.Attempts, 1)),
+		retry.LastErrorOnly(true),
+		retry.RetryIf(func(err error) bool {
+			if !retryable(err) {
+				p.logger().Printf("%s: permanent error, will not retry: %v", p.name(), err)
+				return false
+			}
+			if p.MaxElapsed > 0 {
+				remaining := p.MaxElapsed - time.Since(start)
+				if remaining <= 0 {
+					p.logger().Printf("%s: retry time of %s exhausted: %v", p.name(), p.MaxElapsed, err)
+					return false
+				}
+				// Retrying before the delay requested by the server would only be throttled again.
+				if serverDelay, _ := p.serverDelay(err); serverDelay > remaining {
+					p.logger().Printf("%s: server asked to retry after %s, beyond the remaining retry time of %s: %v",
+						p.name(), serverDelay, remaining.Round(time.Millisecond), err)
+					return false
+				}
+			}
+			return true
+		}),
+		retry.DelayType(func(n uint, err error, _ *retry.Config) time.Duration {
+			delay := p.Delay(n, err)
+			serverDelay, apiErr := p.serverDelay(err)
+			if p.MaxElapsed > 0 {
+				// Do not sleep past the elapsed time limit, a last attempt is made when it is reached. The delay
+				// requested by the server is kept, RetryIf gave up if it does not fit.
+				delay = max(min(delay, p.MaxElapsed-time.Since(start)), serverDelay, 0)
+			}
+			if apiErr != nil {
+				p.logger().Printf("%s: server %s asked to retry after %s, waiting %s",
+					p.name(), apiErr.Endpoint, apiErr.RetryAfter, delay.Round(time.Millisecond))
+			}
+			return delay
+		}),
+		retry.OnRetry(func(n uint, err error) {
+			p.logger().Printf("%s: attempt %d failed: %v", p.name(), n+1, err)
+		}),
+	)
+}
+
+// Delay returns the wait before retry n, counted from zero, after err. It is a random duration up to the
+// exponential backoff bound, but at least the delay requested by the server, capped by MaxServerDelay.
+func (p Policy) Delay(n uint, err error) time.Duration {
+	bound := p.InitialDelay
+	for range n {
+		if p.MaxDelay > 0 && bound >= p.MaxDelay {
+			break
+		}
+		bound *= 2
+	}
+	if p.MaxDelay > 0 {
+		bound = min(bound, p.MaxDelay)
+	}
+
+	var delay time.Duration
+	if bound > 0 {
+		delay = rand.N(bound + 1)
+	}
+
+	serverDelay, _ := p.serverDelay(err)
+
+	return max(delay, serverDelay)
+}
+
+// serverDelay returns the delay the server asked for before retrying after err, capped by MaxServerDelay, with
+// the error carrying it. It is zero if the server asked for none.
+func (p Policy) serverDelay(err error) (time.Duration, *httpclient.APIError) {
+	var apiErr *httpclient.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return min(apiErr.RetryAfter, p.MaxServerDelay), apiErr
+	}
+
+	return 0, nil
+}
+
+// name returns the name of the operation for log messages.
+func (p Policy) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	return "operation"
+}
+
+// logger returns the logger of the policy.
+func (p Policy) logger() *log.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+
+	return log.Default()
+}
+
+// permanentError marks an error as not worth retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, for instance because it was already retried by an inner policy.
+// It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsTransient reports whether an operation failing with err is worth retrying. Context errors, calls rejected
+// by an open circuit breaker, errors marked Permanent and failures the server reported as permanent, such as
+// rejected credentials or revoked access, are not.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	// The breaker is open because the endpoint is down, retrying before its cooldown would only be rejected.
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		return false
+	}
+
+	var apiErr *httpclient.APIError
+	if errors.As(err, &apiErr) && apiErr.IsPermanent() {
+		return false
+	}
+
+	return true
+}
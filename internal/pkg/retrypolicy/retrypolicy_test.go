@@ -0,0 +1,264 @@
+package retrypolicy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piplabs/story-guardian/internal/pkg/circuitbreaker"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
+)
+
+func TestPolicy_Do(t *testing.T) {
+	transient := errors.New("connection reset by peer")
+	permanent := &httpclient.APIError{StatusCode: http.StatusUnauthorized, Code: "invalid_client"}
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "zero policy runs once",
+			policy:       Policy{},
+			errs:         []error{transient, nil},
+			wantAttempts: 1,
+			wantErr:      transient,
+		},
+		{
+			name:         "retried until success",
+			policy:       Policy{Attempts: 5, InitialDelay: time.Millisecond},
+			errs:         []error{transient, transient, nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			policy:       Policy{Attempts: 3, InitialDelay: time.Millisecond},
+			errs:         []error{transient, transient, transient, nil},
+			wantAttempts: 3,
+			wantErr:      transient,
+		},
+		{
+			name:         "permanent error not retried",
+			policy:       Policy{Attempts: 5, InitialDelay: time.Millisecond},
+			errs:         []error{fmt.Errorf("download failed: %w", permanent), nil},
+			wantAttempts: 1,
+			wantErr:      permanent,
+		},
+		{
+			name:         "custom classification",
+			policy:       Policy{Attempts: 5, InitialDelay: time.Millisecond, Retryable: func(err error) bool { return !errors.Is(err, transient) }},
+			errs:         []error{transient, nil},
+			wantAttempts: 1,
+			wantErr:      transient,
+		},
+		{
+			name:         "elapsed time exhausted",
+			policy:       Policy{Attempts: 100, InitialDelay: 20 * time.Millisecond, MaxElapsed: 30 * time.Millisecond},
+			errs:         []error{transient},
+			wantAttempts: -1,
+			wantErr:      transient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Logger = log.New(io.Discard, "", 0)
+			attempts := 0
+			err := tt.policy.Do(context.Background(), func(context.Context) error {
+				// The last error repeats for further attempts.
+				err := tt.errs[min(attempts, len(tt.errs)-1)]
+				attempts++
+				return err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			// The number of attempts within the elapsed time depends on the random delays.
+			if tt.wantAttempts >= 0 && attempts != tt.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPolicy_Do_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{Attempts: 5, InitialDelay: time.Hour, Logger: log.New(io.Discard, "", 0)}
+
+	attempts := 0
+	err := policy.Do(ctx, func(context.Context) error {
+		attempts++
+		cancel()
+		return errors.New("connection reset by peer")
+	})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("Do() = %v after %d attempts, want an error after 1 attempt", err, attempts)
+	}
+}
+
+func TestPolicy_Do_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   time.Duration
+		maxElapsed   time.Duration
+		wantAttempts int
+		wantLog      string
+	}{
+		{
+			name:         "server delay within the retry time is waited",
+			retryAfter:   20 * time.Millisecond,
+			maxElapsed:   time.Minute,
+			wantAttempts: 2,
+			wantLog:      "waiting 20ms",
+		},
+		{
+			name:         "server delay beyond the retry time stops retrying",
+			retryAfter:   2 * time.Minute,
+			maxElapsed:   50 * time.Millisecond,
+			wantAttempts: 1,
+			wantLog:      "beyond the remaining retry time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			policy := Policy{Attempts: 2, MaxElapsed: tt.maxElapsed, MaxServerDelay: time.Hour, Logger: log.New(&logs, "", 0)}
+			throttled := &httpclient.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: tt.retryAfter}
+
+			attempts := 0
+			start := time.Now()
+			err := policy.Do(context.Background(), func(context.Context) error {
+				attempts++
+				return throttled
+			})
+
+			if !errors.Is(err, throttled) || attempts != tt.wantAttempts {
+				t.Errorf("Do() = %v after %d attempts, want %v after %d", err, attempts, throttled, tt.wantAttempts)
+			}
+			// The server delay is never shortened to fit the retry time.
+			if elapsed := time.Since(start); tt.wantAttempts > 1 && elapsed < tt.retryAfter || elapsed > time.Second {
+				t.Errorf("Do() took %s", elapsed)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("Do() logged %q, want %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := Policy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, MaxServerDelay: time.Minute, Logger: log.New(io.Discard, "", 0)}
+	networkErr := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name    string
+		n       uint
+		err     error
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "first retry",
+			n:       0,
+			err:     networkErr,
+			wantMax: time.Second,
+		},
+		{
+			name:    "bound doubles",
+			n:       2,
+			err:     networkErr,
+			wantMax: 4 * time.Second,
+		},
+		{
+			name:    "bound capped",
+			n:       60,
+			err:     networkErr,
+			wantMax: 10 * time.Second,
+		},
+		{
+			name:    "server asks for a longer delay",
+			n:       0,
+			err:     fmt.Errorf("upload failed: %w", &httpclient.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second}),
+			wantMin: 30 * time.Second,
+			wantMax: 30 * time.Second,
+		},
+		{
+			name:    "requested delay capped",
+			n:       0,
+			err:     fmt.Errorf("download failed: %w", &httpclient.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}),
+			wantMin: time.Minute,
+			wantMax: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if got := policy.Delay(tt.n, tt.err); got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("Delay() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "network error",
+			err:  errors.New("connection reset by peer"),
+			want: true,
+		},
+		{
+			name: "context canceled",
+			err:  fmt.Errorf("download failed: %w", context.Canceled),
+			want: false,
+		},
+		{
+			name: "circuit breaker open",
+			err:  fmt.Errorf("download failed: %w", &circuitbreaker.OpenError{Endpoint: "svc.cipherowl.ai/oauth/token"}),
+			want: false,
+		},
+		{
+			name: "server fault",
+			err:  fmt.Errorf("download failed: %w", &httpclient.APIError{StatusCode: http.StatusServiceUnavailable}),
+			want: true,
+		},
+		{
+			name: "bad credentials",
+			err:  fmt.Errorf("download failed: %w", &httpclient.APIError{StatusCode: http.StatusUnauthorized, Code: "invalid_client"}),
+			want: false,
+		},
+		{
+			name: "revoked access",
+			err:  fmt.Errorf("upload failed: %w", &httpclient.APIError{StatusCode: http.StatusForbidden}),
+			want: false,
+		},
+		{
+			name: "already retried",
+			err:  fmt.Errorf("failed to get access token: %w", Permanent(&httpclient.APIError{StatusCode: http.StatusServiceUnavailable})),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package report
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FieldCounterparty is a pseudo field selecting whichever of "from" and "to" is not the filtered address. If that
+// cannot be told, both are selected, so the counterparty is never uploaded unredacted.
+const FieldCounterparty = "counterparty"
+
+// DefaultTruncateLength is the number of characters kept by the truncate action if no length is configured.
+const DefaultTruncateLength = 10
+
+// maxLineSize bounds the length of a single report line.
+const maxLineSize = 1 << 20
+
+// Action is the redaction applied to a report field before upload.
+type Action string
+
+const (
+	// ActionKeep uploads the field unchanged.
+	ActionKeep Action = "keep"
+	// ActionDrop removes the field from the uploaded line.
+	ActionDrop Action = "drop"
+	// ActionHash replaces the field with its salted SHA-256 hash.
+	ActionHash Action = "hash"
+	// ActionTruncate keeps only the leading characters of the field.
+	ActionTruncate Action = "truncate"
+)
+
+// Policy describes how every field of a report line is redacted before upload.
+// Fields without an action are kept.
+type Policy struct {
+	actions        map[string]Action
+	salt           string
+	truncateLength int
+}
+
+// NewPolicy builds a redaction policy from a field to action mapping.
+// The salt is required as soon as a field is hashed.
+func NewPolicy(fields map[string]string, salt string, truncateLength int) (Policy, error) {
+	if truncateLength < 0 {
+		return Policy{}, fmt.Errorf("redaction truncate length must not be negative")
+	}
+	if truncateLength == 0 {
+		truncateLength = DefaultTruncateLength
+	}
+
+	actions := make(map[string]Action, len(fields))
+	for key, value := range fields {
+		action := Action(strings.ToLower(strings.TrimSpace(value)))
+		switch action {
+		case ActionKeep, ActionDrop, ActionHash, ActionTruncate:
+		default:
+			return Policy{}, fmt.Errorf("unknown redaction action %q for field %q, expected keep, drop, hash or truncate", value, key)
+		}
+		if action == ActionHash && salt == "" {
+			return Policy{}, fmt.Errorf("redaction salt is required to hash field %q", key)
+		}
+		actions[strings.ToLower(strings.TrimSpace(key))] = action
+	}
+
+	return Policy{
+		actions:        actions,
+		salt:           salt,
+		truncateLength: truncateLength,
+	}, nil
+}
+
+// IsEmpty reports whether the policy leaves every field unchanged.
+func (p Policy) IsEmpty() bool {
+	for _, action := range p.actions {
+		if action != ActionKeep {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UnknownFields returns the configured field names that geth does not write, sorted by name.
+func (p Policy) UnknownFields() []string {
+	var unknown []string
+	for key := range p.actions {
+		if key != FieldCounterparty && !IsKnownField(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// Apply returns a copy of the record with the policy applied.
+// An explicit "from" or "to" action takes precedence over the counterparty action.
+func (p Policy) Apply(rec Record) Record {
+	counterparty := counterpartyKeys(rec)
+
+	fields := make([]Field, 0, len(rec.Fields))
+	for _, field := range rec.Fields {
+		action, ok := p.actions[field.Key]
+		if !ok && slices.Contains(counterparty, field.Key) {
+			action = p.actions[FieldCounterparty]
+		}
+
+		switch action {
+		case ActionDrop:
+			continue
+		case ActionHash:
+			field.Value = p.hash(field.Value)
+		case ActionTruncate:
+			field.Value = truncate(field.Value, p.truncateLength)
+		}
+		fields = append(fields, field)
+	}
+
+	return Record{Fields: fields}
+}
+
+// Redact copies the report from src to dst with the policy applied to every line.
+// Lines that cannot be parsed are skipped, since they cannot be redacted, and their number is returned.
+func (p Policy) Redact(dst io.Writer, src io.Reader) (int, error) {
+	if p.IsEmpty() {
+		_, err := io.Copy(dst, src)
+		return 0, err
+	}
+
+	var skipped int
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		rec, err := ParseLine(scanner.Text())
+		if err != nil {
+			skipped++
+			continue
+		}
+		if _, err := io.WriteString(dst, p.Apply(rec).String()+"\n"); err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, scanner.Err()
+}
+
+// hash returns the hex encoded SHA-256 hash of the salted value.
+func (p Policy) hash(value string) string {
+	sum := sha256.Sum256([]byte(p.salt + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// counterpartyKeys returns the key of the address field that is not the filtered address. If the filtered
+// address is missing or neither of them, both keys are returned, failing closed.
+func counterpartyKeys(rec Record) []string {
+	if filtered, ok := rec.Get(FieldFilteredAddress); ok {
+		if to, ok := rec.Get(FieldTo); ok && strings.EqualFold(to, filtered) {
+			return []string{FieldFrom}
+		}
+		if from, ok := rec.Get(FieldFrom); ok && strings.EqualFold(from, filtered) {
+			return []string{FieldTo}
+		}
+	}
+
+	return []string{FieldFrom, FieldTo}
+}
+
+// truncate keeps the first n characters of value.
+func truncate(value string, n int) string {
+	runes := []rune(value)
+	if len(runes) <= n {
+		return value
+	}
+
+	return string(runes[:n])
+}
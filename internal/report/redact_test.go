@@ -0,0 +1,168 @@
+package report
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      map[string]string
+		salt        string
+		wantErr     bool
+		wantUnknown []string
+	}{
+		{
+			name:   "valid policy",
+			fields: map[string]string{"value": "drop", "gas_price": "HASH", "counterparty": "truncate"},
+			salt:   "test_salt",
+		},
+		{
+			name:    "unknown action",
+			fields:  map[string]string{"value": "encrypt"},
+			wantErr: true,
+		},
+		{
+			name:    "hash without salt",
+			fields:  map[string]string{"from": "hash"},
+			wantErr: true,
+		},
+		{
+			name:        "unknown field",
+			fields:      map[string]string{"amount": "drop", "value": "keep"},
+			wantUnknown: []string{"amount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.fields, tt.salt, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := policy.UnknownFields(); strings.Join(got, ",") != strings.Join(tt.wantUnknown, ",") {
+				t.Errorf("UnknownFields() = %v, want %v", got, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestPolicy_Apply(t *testing.T) {
+	const salt = "test_salt"
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+		// line is the report line, testReportLine if empty.
+		line   string
+		want   map[string]string
+		absent []string
+	}{
+		{
+			name:   "empty policy keeps every field",
+			fields: nil,
+			want: map[string]string{
+				FieldValue: "0",
+				FieldFrom:  "0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58",
+			},
+		},
+		{
+			name:   "drop removes the field",
+			fields: map[string]string{FieldValue: "drop", FieldGasPrice: "drop"},
+			absent: []string{FieldValue, FieldGasPrice},
+		},
+		{
+			name:   "hash replaces the value with the salted SHA-256",
+			fields: map[string]string{FieldTxHash: "hash"},
+			want: map[string]string{
+				FieldTxHash: sha256Hex(salt + "0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85"),
+			},
+		},
+		{
+			name:   "truncate keeps the leading characters",
+			fields: map[string]string{FieldFilteredAddress: "truncate"},
+			want:   map[string]string{FieldFilteredAddress: "0xf39Fd6e5"},
+		},
+		{
+			name:   "counterparty resolves to the sender when the recipient is filtered",
+			fields: map[string]string{FieldCounterparty: "drop"},
+			want:   map[string]string{FieldTo: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"},
+			absent: []string{FieldFrom},
+		},
+		{
+			name:   "explicit field action takes precedence over counterparty",
+			fields: map[string]string{FieldCounterparty: "drop", FieldFrom: "keep"},
+			want:   map[string]string{FieldFrom: "0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58"},
+		},
+		{
+			name:   "counterparty redacts both addresses when neither is filtered",
+			fields: map[string]string{FieldCounterparty: "drop"},
+			line:   strings.Replace(testReportLine, "to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", "to: 0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1),
+			want:   map[string]string{FieldFilteredAddress: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"},
+			absent: []string{FieldFrom, FieldTo},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.fields, salt, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := tt.line
+			if line == "" {
+				line = testReportLine
+			}
+			rec, err := ParseLine(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := policy.Apply(rec)
+			for key, want := range tt.want {
+				if value, ok := got.Get(key); !ok || value != want {
+					t.Errorf("Apply() %s = %q, want %q", key, value, want)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := got.Get(key); ok {
+					t.Errorf("Apply() kept field %s, want it dropped", key)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicy_Redact(t *testing.T) {
+	policy, err := NewPolicy(map[string]string{FieldValue: "drop"}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := strings.NewReader(testReportLine + "\nnot a report line\n\n" + testReportLine + "\n")
+	var dst bytes.Buffer
+	skipped, err := policy.Redact(&dst, src)
+	if err != nil {
+		t.Fatalf("Redact() error = %v", err)
+	}
+	if skipped != 1 {
+		t.Errorf("Redact() skipped = %d, want 1", skipped)
+	}
+
+	lines := strings.Split(strings.TrimSpace(dst.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Redact() wrote %d lines, want 2", len(lines))
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "value: ") {
+			t.Errorf("Redact() line still contains the value field: %q", line)
+		}
+	}
+}
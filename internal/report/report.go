@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field names written by geth into the filtered report.
+const (
+	FieldTimestamp       = "timestamp"
+	FieldFilteredAddress = "filtered_address"
+	FieldTxHash          = "tx_hash"
+	FieldType            = "type"
+	FieldFrom            = "from"
+	FieldTo              = "to"
+	FieldValue           = "value"
+	FieldNonce           = "nonce"
+	FieldGas             = "gas"
+	FieldGasPrice        = "gas_price"
+)
+
+const (
+	fieldSeparator    = ", "
+	keyValueSeparator = ": "
+)
+
+// KnownFields lists the fields of a report line in the order geth writes them.
+var KnownFields = []string{
+	FieldTimestamp,
+	FieldFilteredAddress,
+	FieldTxHash,
+	FieldType,
+	FieldFrom,
+	FieldTo,
+	FieldValue,
+	FieldNonce,
+	FieldGas,
+	FieldGasPrice,
+}
+
+// Field is a single key-value pair of a report line.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Record is a parsed report line, keeping the order of its fields.
+type Record struct {
+	Fields []Field
+}
+
+// ParseLine parses a report line of the form "key: value, key: value, ...".
+func ParseLine(line string) (Record, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return Record{}, fmt.Errorf("empty report line")
+	}
+
+	parts := strings.Split(line, fieldSeparator)
+	fields := make([]Field, 0, len(parts))
+	for _, part := range parts {
+		key, value, ok := strings.Cut(part, keyValueSeparator)
+		if !ok {
+			return Record{}, fmt.Errorf("malformed report field %q", part)
+		}
+		fields = append(fields, Field{
+			Key:   strings.TrimSpace(key),
+			Value: strings.TrimSpace(value),
+		})
+	}
+
+	return Record{Fields: fields}, nil
+}
+
+// Get returns the value of the field with the given key.
+func (r Record) Get(key string) (string, bool) {
+	for _, field := range r.Fields {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// String formats the record back into the report line format.
+func (r Record) String() string {
+	var sb strings.Builder
+	for i, field := range r.Fields {
+		if i > 0 {
+			sb.WriteString(fieldSeparator)
+		}
+		sb.WriteString(field.Key)
+		sb.WriteString(keyValueSeparator)
+		sb.WriteString(field.Value)
+	}
+
+	return sb.String()
+}
+
+// IsKnownField reports whether key is a field written by geth.
+func IsKnownField(key string) bool {
+	for _, known := range KnownFields {
+		if key == known {
+			return true
+		}
+	}
+
+	return false
+}
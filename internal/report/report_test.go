@@ -0,0 +1,53 @@
+package report
+
+import (
+	"testing"
+)
+
+const testReportLine = "timestamp: 2024-11-14T17:14:05+08:00, filtered_address: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, tx_hash: 0xe3bcd00a87ca32a507c30864511e1469badbed066d719e48c43e4b2fbe2e8b85, type: 0, from: 0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58, to: 0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, value: 0, nonce: 0, gas: 0, gas_price: 0"
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "geth report line",
+			line: testReportLine,
+			want: map[string]string{
+				FieldTimestamp:       "2024-11-14T17:14:05+08:00",
+				FieldFilteredAddress: "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+				FieldFrom:            "0x32E89fEAd3b7E77dD8B26206c0607ecC6FAFBa58",
+				FieldGasPrice:        "0",
+			},
+		},
+		{
+			name:    "empty line",
+			line:    "  ",
+			wantErr: true,
+		},
+		{
+			name:    "malformed field",
+			line:    "timestamp: 2024-11-14T17:14:05+08:00, garbage",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for key, want := range tt.want {
+				if value, ok := got.Get(key); !ok || value != want {
+					t.Errorf("ParseLine() %s = %q, want %q", key, value, want)
+				}
+			}
+			if !tt.wantErr && got.String() != tt.line {
+				t.Errorf("String() = %q, want %q", got.String(), tt.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"bufio"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dayLayout is the layout of the days in the statistics.
+const dayLayout = "2006-01-02"
+
+// DayCount is the number of filtered transactions of a single day.
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// AddressCount is the number of filtered transactions involving an address.
+type AddressCount struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+// Stats summarizes the filtered transactions of one or more reports.
+type Stats struct {
+	Total                int            `json:"total"`
+	TotalValue           *big.Int       `json:"total_value"`
+	PerDay               []DayCount     `json:"per_day"`
+	TopFilteredAddresses []AddressCount `json:"top_filtered_addresses"`
+	TopSenders           []AddressCount `json:"top_senders"`
+}
+
+// Aggregator accumulates report lines into statistics. Identical lines are counted once,
+// so the same report may be read from several places, such as the report file and its pending batch.
+type Aggregator struct {
+	// Since and Until restrict the statistics to [Since, Until), a zero value leaves the bound open.
+	Since time.Time
+	Until time.Time
+	// Location is the time zone the days are counted in, defaults to the local time zone.
+	Location *time.Location
+
+	seen     map[string]struct{}
+	perDay   map[string]int
+	filtered map[string]int
+	senders  map[string]int
+	total    int
+	value    *big.Int
+}
+
+// NewAggregator creates an Aggregator for the given time range.
+func NewAggregator(since, until time.Time) *Aggregator {
+	return &Aggregator{
+		Since:    since,
+		Until:    until,
+		Location: time.Local,
+		seen:     make(map[string]struct{}),
+		perDay:   make(map[string]int),
+		filtered: make(map[string]int),
+		senders:  make(map[string]int),
+		value:    new(big.Int),
+	}
+}
+
+// AddReader adds every line of a report and returns the number of lines that could not be parsed.
+func (a *Aggregator) AddReader(r io.Reader) (int, error) {
+	var skipped int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if _, ok := a.seen[line]; ok {
+			continue
+		}
+		a.seen[line] = struct{}{}
+
+		rec, err := ParseLine(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if !a.Add(rec) {
+			skipped++
+		}
+	}
+
+	return skipped, scanner.Err()
+}
+
+// Add adds a single record and reports whether it had a valid timestamp.
+// Records outside of the time range are ignored.
+func (a *Aggregator) Add(rec Record) bool {
+	value, _ := rec.Get(FieldTimestamp)
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	if (!a.Since.IsZero() && timestamp.Before(a.Since)) || (!a.Until.IsZero() && !timestamp.Before(a.Until)) {
+		return true
+	}
+
+	a.total++
+	a.perDay[timestamp.In(a.location()).Format(dayLayout)]++
+	if address, ok := rec.Get(FieldFilteredAddress); ok {
+		a.filtered[strings.ToLower(address)]++
+	}
+	if sender, ok := rec.Get(FieldFrom); ok {
+		a.senders[strings.ToLower(sender)]++
+	}
+	if value, ok := rec.Get(FieldValue); ok {
+		if v, ok := new(big.Int).SetString(value, 10); ok {
+			a.value.Add(a.value, v)
+		}
+	}
+
+	return true
+}
+
+// Stats returns the accumulated statistics with at most top entries per address ranking.
+func (a *Aggregator) Stats(top int) Stats {
+	perDay := make([]DayCount, 0, len(a.perDay))
+	for day, count := range a.perDay {
+		perDay = append(perDay, DayCount{Day: day, Count: count})
+	}
+	sort.Slice(perDay, func(i, j int) bool {
+		return perDay[i].Day < perDay[j].Day
+	})
+
+	return Stats{
+		Total:                a.total,
+		TotalValue:           new(big.Int).Set(a.value),
+		PerDay:               perDay,
+		TopFilteredAddresses: topAddresses(a.filtered, top),
+		TopSenders:           topAddresses(a.senders, top),
+	}
+}
+
+func (a *Aggregator) location() *time.Location {
+	if a.Location == nil {
+		return time.Local
+	}
+
+	return a.Location
+}
+
+// topAddresses ranks the addresses by count, breaking ties by address.
+func topAddresses(counts map[string]int, top int) []AddressCount {
+	ranked := make([]AddressCount, 0, len(counts))
+	for address, count := range counts {
+		ranked = append(ranked, AddressCount{Address: address, Count: count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Address < ranked[j].Address
+	})
+	if top >= 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+
+	return ranked
+}
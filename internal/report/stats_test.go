@@ -0,0 +1,81 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	lines := strings.Join([]string{
+		"timestamp: 2024-11-14T17:14:05Z, filtered_address: 0xAAAA, tx_hash: 0x01, type: 0, from: 0xBBBB, to: 0xAAAA, value: 100, nonce: 0, gas: 0, gas_price: 0",
+		"timestamp: 2024-11-14T18:00:00Z, filtered_address: 0xaaaa, tx_hash: 0x02, type: 0, from: 0xBBBB, to: 0xaaaa, value: 200, nonce: 1, gas: 0, gas_price: 0",
+		"timestamp: 2024-11-15T09:30:00Z, filtered_address: 0xCCCC, tx_hash: 0x03, type: 0, from: 0xCCCC, to: 0xDDDD, value: 5, nonce: 0, gas: 0, gas_price: 0",
+		"timestamp: 2024-11-16T09:30:00Z, filtered_address: 0xCCCC, tx_hash: 0x04, type: 0, from: 0xCCCC, to: 0xDDDD, value: 7, nonce: 1, gas: 0, gas_price: 0",
+		"not a report line",
+	}, "\n")
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		until     time.Time
+		wantTotal int
+		wantValue string
+		wantDays  []DayCount
+		wantTop   string
+	}{
+		{
+			name:      "all reports",
+			wantTotal: 4,
+			wantValue: "312",
+			wantDays:  []DayCount{{"2024-11-14", 2}, {"2024-11-15", 1}, {"2024-11-16", 1}},
+			wantTop:   "0xaaaa",
+		},
+		{
+			name:      "time range",
+			since:     time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC),
+			until:     time.Date(2024, 11, 16, 0, 0, 0, 0, time.UTC),
+			wantTotal: 1,
+			wantValue: "5",
+			wantDays:  []DayCount{{"2024-11-15", 1}},
+			wantTop:   "0xcccc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := NewAggregator(tt.since, tt.until)
+			agg.Location = time.UTC
+
+			skipped, err := agg.AddReader(strings.NewReader(lines))
+			if err != nil {
+				t.Fatalf("AddReader() error = %v", err)
+			}
+			if skipped != 1 {
+				t.Errorf("AddReader() skipped = %d, want 1", skipped)
+			}
+			// Reading the same report again, e.g. from its pending batch, must not count twice.
+			if _, err := agg.AddReader(strings.NewReader(lines)); err != nil {
+				t.Fatalf("AddReader() error = %v", err)
+			}
+
+			stats := agg.Stats(1)
+			if stats.Total != tt.wantTotal {
+				t.Errorf("Stats() total = %d, want %d", stats.Total, tt.wantTotal)
+			}
+			if stats.TotalValue.String() != tt.wantValue {
+				t.Errorf("Stats() total value = %s, want %s", stats.TotalValue, tt.wantValue)
+			}
+			if len(stats.PerDay) != len(tt.wantDays) {
+				t.Fatalf("Stats() per day = %v, want %v", stats.PerDay, tt.wantDays)
+			}
+			for i := range tt.wantDays {
+				if stats.PerDay[i] != tt.wantDays[i] {
+					t.Errorf("Stats() per day = %v, want %v", stats.PerDay, tt.wantDays)
+				}
+			}
+			if len(stats.TopFilteredAddresses) != 1 || stats.TopFilteredAddresses[0].Address != tt.wantTop {
+				t.Errorf("Stats() top filtered addresses = %v, want %s first", stats.TopFilteredAddresses, tt.wantTop)
+			}
+		})
+	}
+}
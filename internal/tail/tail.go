@@ -0,0 +1,352 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// readChunkSize is the number of bytes read from the report file at once.
+	readChunkSize = 64 * 1024
+	// fingerprintSize bounds the length of the first line used to recognize a report file.
+	fingerprintSize = 4 * 1024
+)
+
+// Config configures a Tailer.
+type Config struct {
+	// Path is the report file to follow.
+	Path string
+	// OffsetPath is the file persisting the read offset across restarts.
+	OffsetPath string
+	// MaxBatchBytes flushes a batch as soon as it reaches this size.
+	MaxBatchBytes int
+	// FlushInterval flushes a non-empty batch and retries pending uploads at this interval.
+	FlushInterval time.Duration
+	// Stage durably stores a batch of complete lines. The offset is persisted only after Stage succeeded.
+	Stage func(batch []byte) error
+	// Upload sends the staged batches. It is called after every flush and interval, failures are retried later.
+	Upload func(ctx context.Context) error
+}
+
+// state is the persisted position in the report file.
+type state struct {
+	// Offset is the position after the last staged line.
+	Offset int64 `json:"offset"`
+	// Fingerprint identifies the report file by the hash of its first line.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Tailer follows the report file, batching newly appended lines and handing them to the upload.
+// It handles truncation and rotation of the report file.
+type Tailer struct {
+	cfg Config
+
+	file *os.File
+	info os.FileInfo
+
+	// committed is the persisted state, readOffset is the position after the buffered lines.
+	committed  state
+	readOffset int64
+	buf        bytes.Buffer
+}
+
+// New creates a Tailer resuming from the offset persisted in cfg.OffsetPath.
+func New(cfg Config) (*Tailer, error) {
+	if cfg.Path == "" || cfg.OffsetPath == "" {
+		return nil, fmt.Errorf("report and offset file paths are required")
+	}
+	if cfg.MaxBatchBytes <= 0 || cfg.FlushInterval <= 0 {
+		return nil, fmt.Errorf("batch size and flush interval must be positive")
+	}
+	if cfg.Stage == nil || cfg.Upload == nil {
+		return nil, fmt.Errorf("stage and upload functions are required")
+	}
+
+	t := &Tailer{cfg: cfg}
+	if err := t.loadState(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Run follows the report file until the context is done.
+func (t *Tailer) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directory, so a report file created after a rotation is noticed as well.
+	if err := watcher.Add(filepath.Dir(t.cfg.Path)); err != nil {
+		return err
+	}
+	defer t.closeFile()
+
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	t.step(ctx, false)
+	for {
+		select {
+		case <-ctx.Done():
+			// Stage what has been read so far, the upload resumes after the restart.
+			if err := t.flush(); err != nil {
+				log.Printf("tail: failed to stage batch on shutdown: %v", err)
+			}
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(t.cfg.Path) {
+				t.step(ctx, false)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("tail: file watcher error: %v", err)
+		case <-ticker.C:
+			t.step(ctx, true)
+		}
+	}
+}
+
+// step reads new lines and flushes the batch if it is full or the interval elapsed.
+func (t *Tailer) step(ctx context.Context, interval bool) {
+	flushed, err := t.poll()
+	if err != nil {
+		log.Printf("tail: failed to read %s: %v", t.cfg.Path, err)
+	}
+
+	if interval {
+		if err := t.flush(); err != nil {
+			log.Printf("tail: failed to stage batch: %v", err)
+			return
+		}
+		flushed = true
+	}
+
+	if flushed {
+		if err := t.cfg.Upload(ctx); err != nil {
+			log.Printf("tail: failed to upload report batches: %v", err)
+		}
+	}
+}
+
+// poll reads all complete lines appended since the last call, following truncation and rotation.
+// It reports whether a full batch was flushed.
+func (t *Tailer) poll() (bool, error) {
+	if t.file == nil {
+		if err := t.openFile(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	info, err := os.Stat(t.cfg.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) || (err == nil && !os.SameFile(t.info, info)):
+		// The report file was rotated, finish the old file before switching to the new one.
+		flushed, err := t.drain()
+		if err != nil {
+			return flushed, err
+		}
+		if err := t.flush(); err != nil {
+			return flushed, err
+		}
+		t.closeFile()
+		t.reset()
+		if err := t.saveState(); err != nil {
+			return flushed, err
+		}
+		more, err := t.poll()
+		return flushed || more, err
+	case err != nil:
+		return false, err
+	case info.Size() < t.readOffset:
+		// The report file was truncated, what was read before remains valid.
+		if err := t.flush(); err != nil {
+			return false, err
+		}
+		t.reset()
+		if err := t.saveState(); err != nil {
+			return false, err
+		}
+	}
+
+	return t.drain()
+}
+
+// drain reads the open file up to its end, flushing every full batch.
+func (t *Tailer) drain() (bool, error) {
+	var flushed bool
+	for {
+		n, err := t.readLines()
+		if err != nil {
+			return flushed, err
+		}
+		if t.buf.Len() >= t.cfg.MaxBatchBytes {
+			if err := t.flush(); err != nil {
+				return flushed, err
+			}
+			flushed = true
+		}
+		if n == 0 {
+			return flushed, nil
+		}
+	}
+}
+
+// readLines appends the complete lines of the next chunk to the batch and returns the number of bytes consumed.
+func (t *Tailer) readLines() (int, error) {
+	chunk := make([]byte, readChunkSize)
+	n, err := t.file.ReadAt(chunk, t.readOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	// Keep a trailing partial line for the next read.
+	end := bytes.LastIndexByte(chunk[:n], '\n') + 1
+	if end == 0 {
+		return 0, nil
+	}
+	if t.readOffset == 0 && t.committed.Fingerprint == "" {
+		t.committed.Fingerprint = fingerprint(chunk[:end])
+	}
+	t.buf.Write(chunk[:end])
+	t.readOffset += int64(end)
+
+	return end, nil
+}
+
+// flush stages the buffered lines and persists the new offset.
+func (t *Tailer) flush() error {
+	if t.buf.Len() == 0 {
+		return nil
+	}
+	if err := t.cfg.Stage(bytes.Clone(t.buf.Bytes())); err != nil {
+		return err
+	}
+	t.buf.Reset()
+	t.committed.Offset = t.readOffset
+
+	return t.saveState()
+}
+
+// openFile opens the report file and resumes at the committed offset, unless it is a different file.
+func (t *Tailer) openFile() error {
+	file, err := os.Open(t.cfg.Path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	current, err := readFingerprint(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if t.committed.Fingerprint != current || info.Size() < t.committed.Offset {
+		// Either a new report file or the old one was truncated while nobody was watching.
+		if t.committed.Offset > 0 {
+			log.Printf("tail: %s was replaced, reading it from the start", t.cfg.Path)
+		}
+		t.committed = state{Fingerprint: current}
+	}
+
+	t.file = file
+	t.info = info
+	t.readOffset = t.committed.Offset
+
+	return nil
+}
+
+// closeFile closes the report file if it is open.
+func (t *Tailer) closeFile() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+		t.info = nil
+	}
+}
+
+// reset starts over at the beginning of the report file.
+func (t *Tailer) reset() {
+	t.committed = state{}
+	t.readOffset = 0
+	t.buf.Reset()
+}
+
+// loadState reads the persisted offset, a missing file starts at the beginning.
+func (t *Tailer) loadState() error {
+	data, err := os.ReadFile(t.cfg.OffsetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &t.committed)
+}
+
+// saveState atomically persists the committed offset.
+func (t *Tailer) saveState() error {
+	data, err := json.Marshal(t.committed)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := t.cfg.OffsetPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, t.cfg.OffsetPath)
+}
+
+// readFingerprint returns the fingerprint of the first complete line of the file, or an empty string.
+func readFingerprint(file *os.File) (string, error) {
+	head := make([]byte, fingerprintSize)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return fingerprint(head[:n]), nil
+}
+
+// fingerprint hashes the first complete line of data, a line longer than fingerprintSize has no fingerprint.
+func fingerprint(data []byte) string {
+	if len(data) > fingerprintSize {
+		data = data[:fingerprintSize]
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		return ""
+	}
+	sum := sha256.Sum256(data[:end])
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,226 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the staged batches of a Tailer.
+type recorder struct {
+	mu      sync.Mutex
+	batches []string
+}
+
+func (r *recorder) stage(batch []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, string(batch))
+	return nil
+}
+
+func (r *recorder) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Fields(strings.Join(r.batches, ""))
+}
+
+func newTestTailer(t *testing.T, dir string, rec *recorder, maxBatchBytes int) *Tailer {
+	t.Helper()
+
+	tailer, err := New(Config{
+		Path:          filepath.Join(dir, "filtered_report.log"),
+		OffsetPath:    filepath.Join(dir, "filtered_report.offset"),
+		MaxBatchBytes: maxBatchBytes,
+		FlushInterval: time.Hour,
+		Stage:         rec.stage,
+		Upload:        func(context.Context) error { return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tailer
+}
+
+func appendLines(t *testing.T, path, content string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pollAndFlush reads the new lines and stages them like an elapsed flush interval would.
+func pollAndFlush(t *testing.T, tailer *Tailer) {
+	t.Helper()
+
+	if _, err := tailer.poll(); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if err := tailer.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+}
+
+func assertLines(t *testing.T, rec *recorder, want ...string) {
+	t.Helper()
+
+	if got := rec.lines(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("staged lines = %v, want %v", got, want)
+	}
+}
+
+func TestTailer_PartialLines(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	tailer := newTestTailer(t, dir, rec, 1<<20)
+	defer tailer.closeFile()
+
+	appendLines(t, tailer.cfg.Path, "line1\nline2\nli")
+	pollAndFlush(t, tailer)
+	assertLines(t, rec, "line1", "line2")
+
+	appendLines(t, tailer.cfg.Path, "ne3\n")
+	pollAndFlush(t, tailer)
+	assertLines(t, rec, "line1", "line2", "line3")
+}
+
+func TestTailer_BatchSize(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	tailer := newTestTailer(t, dir, rec, len("line1\n"))
+	defer tailer.closeFile()
+
+	appendLines(t, tailer.cfg.Path, "line1\n")
+	flushed, err := tailer.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !flushed {
+		t.Errorf("poll() flushed = false, want a full batch to be flushed")
+	}
+	assertLines(t, rec, "line1")
+}
+
+func TestTailer_Truncate(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	tailer := newTestTailer(t, dir, rec, 1<<20)
+	defer tailer.closeFile()
+
+	appendLines(t, tailer.cfg.Path, "line1\nline2\n")
+	pollAndFlush(t, tailer)
+
+	if err := os.Truncate(tailer.cfg.Path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, tailer.cfg.Path, "line3\n")
+	pollAndFlush(t, tailer)
+	assertLines(t, rec, "line1", "line2", "line3")
+}
+
+func TestTailer_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	tailer := newTestTailer(t, dir, rec, 1<<20)
+	defer tailer.closeFile()
+
+	appendLines(t, tailer.cfg.Path, "line1\n")
+	pollAndFlush(t, tailer)
+
+	// Lines written to the old file before the rotation must not be lost.
+	appendLines(t, tailer.cfg.Path, "line2\n")
+	if err := os.Rename(tailer.cfg.Path, tailer.cfg.Path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, tailer.cfg.Path, "line3\n")
+	pollAndFlush(t, tailer)
+	assertLines(t, rec, "line1", "line2", "line3")
+}
+
+func TestTailer_Restart(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	tailer := newTestTailer(t, dir, rec, 1<<20)
+
+	appendLines(t, tailer.cfg.Path, "line1\nline2\n")
+	pollAndFlush(t, tailer)
+	// Lines read but not staged before the restart are read again.
+	appendLines(t, tailer.cfg.Path, "line3\n")
+	if _, err := tailer.poll(); err != nil {
+		t.Fatal(err)
+	}
+	tailer.closeFile()
+
+	restarted := newTestTailer(t, dir, rec, 1<<20)
+	defer restarted.closeFile()
+	appendLines(t, restarted.cfg.Path, "line4\n")
+	pollAndFlush(t, restarted)
+	assertLines(t, rec, "line1", "line2", "line3", "line4")
+
+	// A report file replaced while the tailer was down is read from the start.
+	restarted.closeFile()
+	if err := os.Remove(restarted.cfg.Path); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, restarted.cfg.Path, "line5\nline6\nline7\nline8\n")
+	replaced := newTestTailer(t, dir, rec, 1<<20)
+	defer replaced.closeFile()
+	pollAndFlush(t, replaced)
+	assertLines(t, rec, "line1", "line2", "line3", "line4", "line5", "line6", "line7", "line8")
+}
+
+func TestTailer_Run(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	uploaded := make(chan struct{}, 1)
+
+	tailer, err := New(Config{
+		Path:          filepath.Join(dir, "filtered_report.log"),
+		OffsetPath:    filepath.Join(dir, "filtered_report.offset"),
+		MaxBatchBytes: 1 << 20,
+		FlushInterval: 20 * time.Millisecond,
+		Stage:         rec.stage,
+		Upload: func(context.Context) error {
+			select {
+			case uploaded <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tailer.Run(ctx) }()
+
+	appendLines(t, filepath.Join(dir, "filtered_report.log"), "line1\n")
+	deadline := time.After(5 * time.Second)
+	for len(rec.lines()) == 0 {
+		select {
+		case <-uploaded:
+		case <-deadline:
+			t.Fatal("timed out waiting for the batch to be staged")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	assertLines(t, rec, "line1")
+}
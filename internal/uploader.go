@@ -3,23 +3,74 @@ package internal
 import (
 	"bytes"
 	"context"
-	"io"
+	"log"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+
+	"github.com/piplabs/story-guardian/internal/archive"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+	"github.com/piplabs/story-guardian/internal/report"
+	"github.com/piplabs/story-guardian/utils/ctxutil"
 )
 
 // UploadReportFile uploads the filtered report file to the CipherOwl server.
-func UploadReportFile(ctx context.Context, filePath string) error {
-	// Check if the file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil
+//
+// The report file is first moved into the pending directory as a batch named after its content hash,
+// then every pending batch is uploaded. A batch that already has a receipt was accepted before and is
+// not uploaded again.
+func UploadReportFile(ctx context.Context, api cipherowl.API, filePath string) error {
+	if _, err := rotateReportFile(filePath, PendingDir(filePath)); err != nil {
+		return err
 	}
 
-	srcFile, err := os.Open(filePath)
+	return UploadPendingBatches(ctx, api, filePath)
+}
+
+// UploadPendingBatches uploads every pending batch of the given report file, oldest first.
+func UploadPendingBatches(ctx context.Context, api cipherowl.API, reportFilePath string) error {
+	batches, err := pendingBatches(PendingDir(reportFilePath))
 	if err != nil {
 		return err
 	}
+	for _, batch := range batches {
+		if err := uploadBatch(ctx, api, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadBatch uploads a single pending batch unless it has a receipt, then finalizes it.
+func uploadBatch(ctx context.Context, api cipherowl.API, batchFilePath string) error {
+	receipt, err := readReceipt(batchFilePath)
+	if err != nil {
+		return err
+	}
+
+	if receipt != nil {
+		log.Printf("batch %s was already uploaded, skipping replay", receipt.BatchID)
+	} else {
+		id := batchIDFromPath(batchFilePath)
+		if receipt, err = uploadBatchFile(ctx, api, id, batchFilePath); err != nil {
+			return err
+		}
+		// Persist the receipt before touching the batch, so a crash does not lead to a replay.
+		if err := writeReceipt(batchFilePath, receipt); err != nil {
+			return err
+		}
+	}
+
+	return finalizeBatch(ctx, batchFilePath, receipt)
+}
+
+// uploadBatchFile sends the content of a batch file as multipart form to the CipherOwl server.
+func uploadBatchFile(ctx context.Context, api cipherowl.API, batchID, batchFilePath string) (*cipherowl.UploadReceipt, error) {
+	srcFile, err := os.Open(batchFilePath)
+	if err != nil {
+		return nil, err
+	}
 	defer srcFile.Close()
 
 	buf := new(bytes.Buffer)
@@ -27,20 +78,52 @@ func UploadReportFile(ctx context.Context, filePath string) error {
 
 	dstFile, err := w.CreateFormFile("file", filepath.Base(srcFile.Name()))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return err
+
+	// Apply the redaction policy, the local batch keeps the original content
+	var policy report.Policy
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil {
+		if policy, err = conf.Redaction.Policy(); err != nil {
+			return nil, err
+		}
+	}
+	skipped, err := policy.Redact(dstFile, srcFile)
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d malformed lines of batch %s that cannot be redacted", skipped, batchID)
 	}
 	if err := w.Close(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Upload the report file
-	if err := uploadReportFile(ctx, buf, w.FormDataContentType()); err != nil {
+	return api.UploadReport(ctx, batchID, buf.Bytes(), w.FormDataContentType())
+}
+
+// finalizeBatch archives an uploaded batch if archiving is enabled and removes it with its receipt.
+func finalizeBatch(ctx context.Context, batchFilePath string, receipt *cipherowl.UploadReceipt) error {
+	// Keep a compressed copy of the uploaded report if archiving is enabled
+	if conf := ctxutil.GetAppConfig(ctx); conf != nil && conf.Archive.Enabled {
+		archiver := archive.New(conf.Archive.Dir, conf.Archive.MaxAge, conf.Archive.MaxSize)
+		entry := archive.Entry{
+			BatchID:    receipt.BatchID,
+			ReceiptID:  receipt.ReceiptID,
+			UploadedAt: receipt.UploadedAt,
+			Status:     receipt.StatusCode,
+		}
+		if _, err := archiver.Store(batchFilePath, entry); err != nil {
+			// The report was accepted by the server, so a failed archive must not trigger a re-upload.
+			log.Printf("failed to archive uploaded batch %s: %v", receipt.BatchID, err)
+		}
+	}
+
+	// Remove the batch after uploading, the receipt goes last so an interrupted cleanup is not replayed
+	if err := os.Remove(batchFilePath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	// Remove the file after uploading
-	return os.Remove(filePath)
+	return os.Remove(receiptPath(batchFilePath))
 }
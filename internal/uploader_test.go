@@ -7,9 +7,8 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/jarcoal/httpmock"
-
-	"github.com/piplabs/story-guardian/utils/ctxutil"
+	"github.com/piplabs/story-guardian/internal/cipherowl"
+	"github.com/piplabs/story-guardian/internal/pkg/httpclient"
 )
 
 var (
@@ -17,11 +16,7 @@ var (
 )
 
 func TestUploadReportFile(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	ctx := context.Background()
-	ctxutil.WithAccessToken(ctx, "test_access_token")
 
 	type args struct {
 		ctx      context.Context
@@ -31,7 +26,7 @@ func TestUploadReportFile(t *testing.T) {
 		name    string
 		args    args
 		wantErr bool
-		mock    func()
+		mock    func(api *cipherowl.Fake)
 	}{
 		{
 			name: "successful upload",
@@ -40,10 +35,6 @@ func TestUploadReportFile(t *testing.T) {
 				filePath: testReportFilePath,
 			},
 			wantErr: false,
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodPost, UploadFileURL,
-					httpmock.NewStringResponder(http.StatusOK, `{"status": "success"}`))
-			},
 		},
 		{
 			name: "failed upload",
@@ -52,17 +43,18 @@ func TestUploadReportFile(t *testing.T) {
 				filePath: testReportFilePath,
 			},
 			wantErr: true,
-			mock: func() {
-				httpmock.RegisterResponder(http.MethodPost, UploadFileURL,
-					httpmock.NewStringResponder(http.StatusBadRequest, `{"error": "invalid_file"}`))
+			mock: func(api *cipherowl.Fake) {
+				api.UploadErr = &httpclient.APIError{StatusCode: http.StatusBadRequest, Code: "invalid_file"}
 			},
 		},
 	}
 	for _, tt := range tests {
-		if tt.mock != nil {
-			tt.mock()
-		}
 		t.Run(tt.name, func(t *testing.T) {
+			api := cipherowl.NewFake(nil)
+			if tt.mock != nil {
+				tt.mock(api)
+			}
+
 			file, err := os.OpenFile(testReportFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 			if err != nil {
 				t.Fatal(err)
@@ -77,9 +69,39 @@ func TestUploadReportFile(t *testing.T) {
 				defer os.Remove(testReportFilePath)
 			}
 
-			if err := UploadReportFile(tt.args.ctx, tt.args.filePath); (err != nil) != tt.wantErr {
+			if err := UploadReportFile(tt.args.ctx, api, tt.args.filePath); (err != nil) != tt.wantErr {
 				t.Errorf("UploadReportFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestUploadReportFile_SkipsReplayedBatch(t *testing.T) {
+	reportFilePath := filepath.Join(t.TempDir(), "filtered_report.log")
+	pendingDir := PendingDir(reportFilePath)
+	if err := os.MkdirAll(pendingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch whose receipt was written before the process stopped must not be uploaded again.
+	batchFilePath := batchPath(pendingDir, "test_batch_id")
+	if err := os.WriteFile(batchFilePath, []byte("test_report_file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReceipt(batchFilePath, &cipherowl.UploadReceipt{BatchID: "test_batch_id", StatusCode: http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+
+	api := cipherowl.NewFake(nil)
+	if err := UploadReportFile(context.Background(), api, reportFilePath); err != nil {
+		t.Fatalf("UploadReportFile() error = %v", err)
+	}
+	if count := api.Calls(); count != 0 {
+		t.Errorf("UploadReportFile() sent %d requests, want 0", count)
+	}
+	for _, path := range []string{batchFilePath, receiptPath(batchFilePath)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, stat error = %v", path, err)
+		}
+	}
+}
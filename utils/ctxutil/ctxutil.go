@@ -9,8 +9,7 @@ import (
 type contentKey string
 
 const (
-	ctxContentAppConfigKey   contentKey = "appConfig"
-	ctxContentAccessTokenKey contentKey = "accessToken"
+	ctxContentAppConfigKey contentKey = "appConfig"
 )
 
 func GetAppConfig(ctx context.Context) *config.AppConfig {
@@ -21,12 +20,3 @@ func GetAppConfig(ctx context.Context) *config.AppConfig {
 func WithAppConfig(ctx context.Context, config *config.AppConfig) context.Context {
 	return context.WithValue(ctx, ctxContentAppConfigKey, config)
 }
-
-func GetAccessToken(ctx context.Context) string {
-	token, _ := ctx.Value(ctxContentAccessTokenKey).(string)
-	return token
-}
-
-func WithAccessToken(ctx context.Context, token string) context.Context {
-	return context.WithValue(ctx, ctxContentAccessTokenKey, token)
-}
@@ -8,18 +8,31 @@ import (
 )
 
 const (
-	linuxPath  = ".story/geth/guardian"
-	darwinPath = "Library/Story/geth/guardian"
+	linuxGethPath  = ".story/geth"
+	darwinGethPath = "Library/Story/geth"
+
+	guardianDirName = "guardian"
 )
 
 // GetDefaultPath determines the default file path based on the operating system.
 func GetDefaultPath() string {
+	return filepath.Join(gethPath(), guardianDirName)
+}
+
+// GetNetworkPath returns the guardian directory of a Story network, next to the geth data directory of the
+// network, such as ~/.story/geth/aeneid/guardian on Linux.
+func GetNetworkPath(network string) string {
+	return filepath.Join(gethPath(), network, guardianDirName)
+}
+
+// gethPath returns the directory of the Story geth data directories based on the operating system.
+func gethPath() string {
 	userHomeDir, _ := os.UserHomeDir()
 	switch runtime.GOOS {
 	case "linux":
-		return filepath.Join(userHomeDir, linuxPath)
+		return filepath.Join(userHomeDir, linuxGethPath)
 	case "darwin":
-		return filepath.Join(userHomeDir, darwinPath)
+		return filepath.Join(userHomeDir, darwinGethPath)
 	default:
 		log.Fatalf("Unsupported operating system: %s", runtime.GOOS)
 		return ""